@@ -0,0 +1,129 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/axfor/bast/auth/jwt"
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/logs"
+)
+
+//authScheme is a named authorization scheme
+type authScheme struct {
+	name      string
+	challenge string
+	handle    AuthorizationHandle
+}
+
+//AuthScheme register a named authorization scheme
+//param:
+//	name is scheme name, such as: jwt, apikey
+//	f is authorization handle of the scheme
+//	challenge is the WWW-Authenticate challenge on failure(default is name)
+func AuthScheme(name string, f AuthorizationHandle, challenge ...string) {
+	if app.schemes == nil {
+		app.schemes = map[string]*authScheme{}
+	}
+	s := &authScheme{name: name, challenge: name, handle: f}
+	if challenge != nil && challenge[0] != "" {
+		s.challenge = challenge[0]
+	}
+	app.schemes[name] = s
+}
+
+//JWT set the jwt signer and verifier of app
+//and register it as 'jwt' authorization scheme(Authorization: Bearer token)
+func JWT(j *jwt.JWT) {
+	app.jwt = j
+	AuthScheme("jwt", jwtAuthorization, "Bearer")
+}
+
+//jwtAuthorization verify the bearer token of current request
+func jwtAuthorization(ctx *Context) error {
+	if app.jwt == nil {
+		return errors.New("jwt is not configured")
+	}
+	token := ctx.In.Header.Get("Authorization")
+	if len(token) < 7 || !strings.EqualFold(token[:7], "Bearer ") {
+		return errors.New("missing bearer token")
+	}
+	claims, err := app.jwt.Verify(strings.TrimSpace(token[7:]))
+	if err != nil {
+		return err
+	}
+	ctx.claims = claims
+	return nil
+}
+
+//authorize run the authorization of the current route
+//any-of the route schemes must pass, or all-of them when route is AuthAll
+//without schemes the global 'authorization' handle is used
+func authorize(ctx *Context) bool {
+	pattern := ctx.Router
+	if len(pattern.schemes) == 0 {
+		if app.Authorization == nil {
+			return true
+		}
+		err := app.Authorization(ctx)
+		if err == nil {
+			return true
+		}
+		unauthorized(ctx, nil, err)
+		return false
+	}
+	var err error
+	challenges := []string{}
+	for _, name := range pattern.schemes {
+		s, ok := app.schemes[name]
+		if !ok {
+			ctx.Log().Error("unknown authorization scheme", logs.String("scheme", name), logs.String("url", ctx.In.RequestURI))
+			err = errors.New("unknown authorization scheme " + name)
+			if pattern.allSchemes {
+				break
+			}
+			continue
+		}
+		e := s.handle(ctx)
+		if e == nil {
+			if !pattern.allSchemes {
+				return true
+			}
+			continue
+		}
+		err = e
+		challenges = append(challenges, s.challenge)
+		if pattern.allSchemes {
+			break
+		}
+	}
+	if pattern.allSchemes && err == nil {
+		return true
+	}
+	unauthorized(ctx, challenges, err)
+	return false
+}
+
+//unauthorized output 401 with the WWW-Authenticate challenges to client
+//the default challenge is used when there's no challenge(see Auth)
+func unauthorized(ctx *Context, challenges []string, err error) {
+	if len(challenges) == 0 {
+		challenges = []string{defaultChallenge()}
+	}
+	for _, c := range challenges {
+		ctx.Out.Header().Add("WWW-Authenticate", c)
+	}
+	ctx.Status(http.StatusUnauthorized)
+	ctx.FailResult(http.StatusText(http.StatusUnauthorized), SerAuthorizationFailed, err)
+}
+
+//defaultChallenge return the WWW-Authenticate challenge of the 'authorization' handle
+func defaultChallenge() string {
+	if app.challenge != "" {
+		return app.challenge
+	}
+	return `Bearer realm="` + strings.ReplaceAll(conf.Realm(), `"`, `\"`) + `"`
+}
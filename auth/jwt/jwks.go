@@ -0,0 +1,180 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+//jwk is a JSON Web Key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+//key is a parsed JSON Web Key
+type key struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+//keySet is the keys of JWKS file
+//the file is reloaded when it has changed(checked each refresh interval)
+type keySet struct {
+	lock    sync.RWMutex
+	path    string
+	refresh time.Duration
+	modTime time.Time
+	checked time.Time
+	keys    []key
+}
+
+//load read and parse the JWKS file
+func (s *keySet) load() error {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.keys = keys
+	s.modTime = fi.ModTime()
+	s.checked = time.Now()
+	s.lock.Unlock()
+	return nil
+}
+
+//check reload the JWKS file if it has changed
+func (s *keySet) check(force bool) {
+	s.lock.RLock()
+	due := force || time.Since(s.checked) >= s.refresh
+	modTime := s.modTime
+	s.lock.RUnlock()
+	if !due {
+		return
+	}
+	s.lock.Lock()
+	s.checked = time.Now()
+	s.lock.Unlock()
+	fi, err := os.Stat(s.path)
+	if err != nil || fi.ModTime().Equal(modTime) {
+		return
+	}
+	s.load()
+}
+
+//find return the keys of kid and alg
+func (s *keySet) find(kid, alg string) []interface{} {
+	s.check(false)
+	ks := s.match(kid, alg)
+	if len(ks) == 0 && kid != "" {
+		//unknown kid, maybe the keys has rotated
+		s.check(true)
+		ks = s.match(kid, alg)
+	}
+	return ks
+}
+
+func (s *keySet) match(kid, alg string) []interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ks := []interface{}{}
+	for _, k := range s.keys {
+		if (kid == "" || k.kid == kid) && k.alg == alg {
+			ks = append(ks, k.key)
+		}
+	}
+	return ks
+}
+
+//parseJWKS parse JWKS data, unsupported keys are skipped
+func parseJWKS(data []byte) ([]key, error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make([]key, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pk, alg, err := k.parse()
+		if err != nil {
+			continue
+		}
+		if k.Alg != "" && k.Alg != alg {
+			continue
+		}
+		keys = append(keys, key{kid: k.Kid, alg: alg, key: pk})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwt: no valid key in JWKS")
+	}
+	return keys, nil
+}
+
+func (k *jwk) parse() (interface{}, string, error) {
+	switch k.Kty {
+	case "oct":
+		b, err := decode(k.K)
+		if err != nil || len(b) == 0 {
+			return nil, "", ErrUnknownKey
+		}
+		return b, HS256, nil
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, "", err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, "", err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, RS256, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, "", ErrAlgorithm
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, "", err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, "", err
+		}
+		pk := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pk.Curve.IsOnCurve(pk.X, pk.Y) {
+			return nil, "", ErrUnknownKey
+		}
+		return pk, ES256, nil
+	}
+	return nil, "", ErrAlgorithm
+}
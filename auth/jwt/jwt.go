@@ -0,0 +1,404 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// Package jwt provides JSON Web Token signing and verification(HS256/RS256/ES256)
+// with key rotation via JWKS file.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+)
+
+//algorithms
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+//errors
+var (
+	ErrInvalidToken    = errors.New("jwt: invalid token")
+	ErrAlgorithm       = errors.New("jwt: unsupported algorithm")
+	ErrUnknownKey      = errors.New("jwt: unknown key")
+	ErrSignature       = errors.New("jwt: invalid signature")
+	ErrExpired         = errors.New("jwt: token is expired")
+	ErrNotValidYet     = errors.New("jwt: token is not valid yet")
+	ErrInvalidIssuer   = errors.New("jwt: invalid issuer")
+	ErrInvalidAudience = errors.New("jwt: invalid audience")
+	ErrNoSigningKey    = errors.New("jwt: no signing key")
+)
+
+//Conf jwt config
+type Conf struct {
+	Alg      string `json:"alg"`      //signing algorithm HS256|RS256|ES256(default is HS256)
+	Secret   string `json:"secret"`   //HS256 secret
+	KeyFile  string `json:"keyFile"`  //RS256|ES256 PEM private key file for signing
+	KeyID    string `json:"kid"`      //key id of signing key
+	JWKS     string `json:"jwks"`     //JWKS file for verification
+	Refresh  int64  `json:"refresh"`  //JWKS file check interval(second default 60s)
+	Issuer   string `json:"issuer"`   //iss
+	Audience string `json:"audience"` //aud
+	TTL      int64  `json:"ttl"`      //token lifetime(second default 3600s)
+	Leeway   int64  `json:"leeway"`   //clock skew of exp/nbf(second)
+}
+
+//Claims jwt claims
+type Claims map[string]interface{}
+
+//Subject return sub claim
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+//String return string claim by key
+func (c Claims) String(key string) string {
+	if v, ok := c[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+//Strings return string array claim by key(a string claim is split by space)
+func (c Claims) Strings(key string) []string {
+	switch v := c[key].(type) {
+	case string:
+		return strings.Fields(v)
+	case []string:
+		return v
+	case []interface{}:
+		ss := make([]string, 0, len(v))
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				ss = append(ss, str)
+			}
+		}
+		return ss
+	}
+	return nil
+}
+
+//Time return numeric date claim by key
+func (c Claims) Time(key string) (time.Time, bool) {
+	switch v := c[key].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case int64:
+		return time.Unix(v, 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		n, err := v.Int64()
+		if err == nil {
+			return time.Unix(n, 0), true
+		}
+		if f, err := v.Float64(); err == nil {
+			return time.Unix(int64(f), 0), true
+		}
+	}
+	return time.Time{}, false
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+//JWT is a jwt signer and verifier
+type JWT struct {
+	conf    *Conf
+	secret  []byte
+	signKey crypto.PrivateKey
+	keys    *keySet
+	now     func() time.Time
+}
+
+//New create a JWT by conf
+func New(c *Conf) (*JWT, error) {
+	if c.Alg == "" {
+		c.Alg = HS256
+	}
+	if c.TTL <= 0 {
+		c.TTL = 3600
+	}
+	if c.Refresh <= 0 {
+		c.Refresh = 60
+	}
+	j := &JWT{conf: c, now: time.Now}
+	switch c.Alg {
+	case HS256:
+		j.secret = []byte(c.Secret)
+	case RS256, ES256:
+		if c.KeyFile != "" {
+			k, err := loadPrivateKey(c.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			j.signKey = k
+		}
+	default:
+		return nil, ErrAlgorithm
+	}
+	if c.JWKS != "" {
+		j.keys = &keySet{path: c.JWKS, refresh: time.Duration(c.Refresh) * time.Second}
+		if err := j.keys.load(); err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+//Conf return jwt conf
+func (j *JWT) Conf() *Conf {
+	return j.conf
+}
+
+//Reload reload the JWKS file
+func (j *JWT) Reload() error {
+	if j.keys == nil {
+		return nil
+	}
+	return j.keys.load()
+}
+
+//Sign create a signed token of claims
+//iat and exp(iat+ttl) and iss are set when they are not in claims
+func (j *JWT) Sign(claims Claims) (string, error) {
+	c := Claims{}
+	for k, v := range claims {
+		c[k] = v
+	}
+	now := j.now()
+	if _, ok := c["iat"]; !ok {
+		c["iat"] = now.Unix()
+	}
+	if _, ok := c["exp"]; !ok {
+		c["exp"] = now.Add(time.Duration(j.conf.TTL) * time.Second).Unix()
+	}
+	if _, ok := c["iss"]; !ok && j.conf.Issuer != "" {
+		c["iss"] = j.conf.Issuer
+	}
+	h, err := json.Marshal(&header{Alg: j.conf.Alg, Typ: "JWT", Kid: j.conf.KeyID})
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	input := encode(h) + "." + encode(p)
+	sig, err := j.sign(input)
+	if err != nil {
+		return "", err
+	}
+	return input + "." + encode(sig), nil
+}
+
+func (j *JWT) sign(input string) ([]byte, error) {
+	switch j.conf.Alg {
+	case HS256:
+		if len(j.secret) == 0 {
+			return nil, ErrNoSigningKey
+		}
+		m := hmac.New(sha256.New, j.secret)
+		m.Write([]byte(input))
+		return m.Sum(nil), nil
+	case RS256:
+		k, ok := j.signKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrNoSigningKey
+		}
+		d := sha256.Sum256([]byte(input))
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, d[:])
+	case ES256:
+		k, ok := j.signKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, ErrNoSigningKey
+		}
+		d := sha256.Sum256([]byte(input))
+		r, s, err := ecdsa.Sign(rand.Reader, k, d[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	}
+	return nil, ErrAlgorithm
+}
+
+//Verify verify the token signature and exp/nbf/iss/aud claims
+func (j *JWT) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	hb, err := decode(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	h := &header{}
+	if err = json.Unmarshal(hb, h); err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := decode(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err = j.verify(h, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+	pb, err := decode(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := Claims{}
+	if err = json.Unmarshal(pb, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err = j.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (j *JWT) verify(h *header, input string, sig []byte) error {
+	keys, err := j.verifyKeys(h)
+	if err != nil {
+		return err
+	}
+	d := sha256.Sum256([]byte(input))
+	for _, k := range keys {
+		switch h.Alg {
+		case HS256:
+			m := hmac.New(sha256.New, k.([]byte))
+			m.Write([]byte(input))
+			if hmac.Equal(sig, m.Sum(nil)) {
+				return nil
+			}
+		case RS256:
+			if rsa.VerifyPKCS1v15(k.(*rsa.PublicKey), crypto.SHA256, d[:], sig) == nil {
+				return nil
+			}
+		case ES256:
+			if len(sig) != 64 {
+				return ErrSignature
+			}
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			if ecdsa.Verify(k.(*ecdsa.PublicKey), d[:], r, s) {
+				return nil
+			}
+		}
+	}
+	return ErrSignature
+}
+
+//verifyKeys return the candidate keys of header
+func (j *JWT) verifyKeys(h *header) ([]interface{}, error) {
+	if h.Alg != HS256 && h.Alg != RS256 && h.Alg != ES256 {
+		return nil, ErrAlgorithm
+	}
+	keys := []interface{}{}
+	if j.keys != nil {
+		keys = j.keys.find(h.Kid, h.Alg)
+	}
+	if h.Kid == "" || h.Kid == j.conf.KeyID {
+		switch h.Alg {
+		case HS256:
+			if len(j.secret) > 0 && j.conf.Alg == HS256 {
+				keys = append(keys, j.secret)
+			}
+		case RS256:
+			if k, ok := j.signKey.(*rsa.PrivateKey); ok {
+				keys = append(keys, &k.PublicKey)
+			}
+		case ES256:
+			if k, ok := j.signKey.(*ecdsa.PrivateKey); ok {
+				keys = append(keys, &k.PublicKey)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, ErrUnknownKey
+	}
+	return keys, nil
+}
+
+//validate check exp/nbf/iss/aud claims, the exp/nbf which is not a NumericDate is invalid
+func (j *JWT) validate(c Claims) error {
+	for _, key := range []string{"exp", "nbf"} {
+		if _, ok := c[key]; !ok {
+			continue
+		}
+		if _, ok := c.Time(key); !ok {
+			return ErrInvalidToken
+		}
+	}
+	now := j.now()
+	leeway := time.Duration(j.conf.Leeway) * time.Second
+	if exp, ok := c.Time("exp"); ok && !now.Before(exp.Add(leeway)) {
+		return ErrExpired
+	}
+	if nbf, ok := c.Time("nbf"); ok && now.Add(leeway).Before(nbf) {
+		return ErrNotValidYet
+	}
+	if j.conf.Issuer != "" && c.String("iss") != j.conf.Issuer {
+		return ErrInvalidIssuer
+	}
+	if j.conf.Audience != "" {
+		for _, aud := range c.Strings("aud") {
+			if aud == j.conf.Audience {
+				return nil
+			}
+		}
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+//loadPrivateKey load PEM private key(PKCS1,PKCS8,EC) from file
+func loadPrivateKey(file string) (crypto.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil, errors.New("jwt: invalid PEM key file")
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(b.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(b.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(b.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,144 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_HS256(t *testing.T) {
+	j, err := New(&Conf{Secret: "bast", Issuer: "bast", Audience: "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := j.Sign(Claims{"sub": "1", "aud": []string{"api", "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := j.Verify(token)
+	if err != nil || c.Subject() != "1" || c.String("iss") != "bast" {
+		t.Fatal(err, c)
+	}
+
+	//tampered payload
+	parts := strings.Split(token, ".")
+	p, _ := json.Marshal(Claims{"sub": "2", "aud": "api", "iss": "bast"})
+	if _, err = j.Verify(parts[0] + "." + encode(p) + "." + parts[2]); err != ErrSignature {
+		t.Error(err)
+	}
+
+	//alg none
+	h, _ := json.Marshal(&header{Alg: "none"})
+	if _, err = j.Verify(encode(h) + "." + parts[1] + "."); err != ErrAlgorithm {
+		t.Error(err)
+	}
+
+	//audience
+	token, _ = j.Sign(Claims{"sub": "1", "aud": "web"})
+	if _, err = j.Verify(token); err != ErrInvalidAudience {
+		t.Error(err)
+	}
+
+	//issuer
+	token, _ = j.Sign(Claims{"sub": "1", "aud": "api", "iss": "other"})
+	if _, err = j.Verify(token); err != ErrInvalidIssuer {
+		t.Error(err)
+	}
+
+	//exp and nbf
+	now := time.Now()
+	token, _ = j.Sign(Claims{"aud": "api", "exp": now.Add(-time.Minute).Unix()})
+	if _, err = j.Verify(token); err != ErrExpired {
+		t.Error(err)
+	}
+	token, _ = j.Sign(Claims{"aud": "api", "nbf": now.Add(time.Minute).Unix()})
+	if _, err = j.Verify(token); err != ErrNotValidYet {
+		t.Error(err)
+	}
+	j.conf.Leeway = 120
+	if _, err = j.Verify(token); err != nil {
+		t.Error(err)
+	}
+
+	//the exp or nbf which is not a NumericDate
+	for _, key := range []string{"exp", "nbf"} {
+		token, _ = j.Sign(Claims{"aud": "api", key: "2030-01-01"})
+		if _, err = j.Verify(token); err != ErrInvalidToken {
+			t.Error(key, err)
+		}
+	}
+}
+
+func Test_JWKS(t *testing.T) {
+	dir := t.TempDir()
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ek, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	rsaFile := filepath.Join(dir, "rsa.pem")
+	ioutil.WriteFile(rsaFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rk)}), 0600)
+	eb, _ := x509.MarshalECPrivateKey(ek)
+	ecFile := filepath.Join(dir, "ec.pem")
+	ioutil.WriteFile(ecFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: eb}), 0600)
+
+	jwks := filepath.Join(dir, "jwks.json")
+	writeJWKS := func(keys ...jwk) {
+		data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+		ioutil.WriteFile(jwks, data, 0600)
+	}
+	rsaKey := jwk{Kty: "RSA", Kid: "r1", N: encode(rk.N.Bytes()), E: encode(big.NewInt(int64(rk.E)).Bytes())}
+	ecKey := jwk{Kty: "EC", Kid: "e1", Crv: "P-256", X: encode(ek.X.Bytes()), Y: encode(ek.Y.Bytes())}
+	writeJWKS(rsaKey)
+
+	rs, err := New(&Conf{Alg: RS256, KeyFile: rsaFile, KeyID: "r1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	es, err := New(&Conf{Alg: ES256, KeyFile: ecFile, KeyID: "e1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := New(&Conf{JWKS: jwks})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := rs.Sign(Claims{"sub": "rsa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := v.Verify(token); err != nil || c.Subject() != "rsa" {
+		t.Error(err)
+	}
+
+	token, err = es.Sign(Claims{"sub": "ec"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := es.Verify(token); err != nil || c.Subject() != "ec" {
+		t.Error(err)
+	}
+	if _, err = v.Verify(token); err != ErrUnknownKey {
+		t.Error(err)
+	}
+
+	//key rotation
+	writeJWKS(rsaKey, ecKey)
+	if err = v.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := v.Verify(token); err != nil || c.Subject() != "ec" {
+		t.Error(err)
+	}
+}
@@ -18,15 +18,20 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/axfor/bast/auth/jwt"
+	"github.com/axfor/bast/cache"
 	"github.com/axfor/bast/conf"
 	"github.com/axfor/bast/guid"
 	"github.com/axfor/bast/httpc"
 	"github.com/axfor/bast/ids"
 	"github.com/axfor/bast/lang"
 	"github.com/axfor/bast/logs"
+	"github.com/axfor/bast/metrics"
+	"github.com/axfor/bast/ratelimit"
 	"github.com/axfor/bast/session"
 	"github.com/axfor/daemon"
 
@@ -38,9 +43,10 @@ import (
 
 // var
 var (
-	flagStart, flagStop, flagReload, flagDaemon                                  bool
+	flagStart, flagStop, flagReload, flagDaemon, flagStatus, flagJSON            bool
 	isInstall, isUninstall, isForce, flagService, isMaster, isClear, isMigration bool
-	flagConf, flagName, flagAppKey, flagPipe                                     string
+	flagConf, flagName, flagAppKey, flagPipe, flagOpenAPI, flagLog               string
+	flagStats, flagReloadConf                                                    bool
 	flagPid                                                                      int
 	app                                                                          *App
 	Log                                                                          *logs.Log
@@ -58,20 +64,48 @@ type App struct {
 	Before                                    BeforeHandle
 	After                                     AfterHandle
 	Authorization                             AuthorizationHandle
+	challenge                                 string //WWW-Authenticate challenge of the 'authorization' handle
 	Migration                                 MigrationHandle
+	Recover                                   RecoverHandle
+	middleware                                []Middleware
+	schemes                                   map[string]*authScheme
+	jwt                                       *jwt.JWT
+	policy                                    PolicyHandle
+	rbac                                      *conf.RBACConf
+	rules                                     map[string]*conf.RBACRule
+	limiters                                  []*limiter
+	limitRules                                map[string]*limiter
+	limitStore                                ratelimit.Store
+	timeout                                   time.Duration
+	compress                                  *conf.CompressConf
+	etag                                      bool
+	cacheStore                                cache.Store
+	metrics                                   bool
+	debugServer                               *http.Server
+	listeners                                 map[string]*os.File //listening sockets of master, key is app key
+	pipe                                      net.Listener        //control pipe of master or work process
+	master                                    *master
+	started                                   time.Time
+	version                                   string
 	Debug, Daemon, isCallCommand, runing, tls bool
 	cmd                                       []work
-	cors                                      *conf.CORSConf
+	cors                                      *corsPolicy
+	preflight                                 *httprouter.Router
 	wrap                                      bool
 	id                                        *snowflake.Node
 	page                                      *conf.PaginationConf
 }
 
 type work struct {
-	key       string
-	cmd       *exec.Cmd
-	runing    bool
-	exitCount int
+	key        string
+	index      int //index in the work processes of app key
+	cmd        *exec.Cmd
+	runing     bool
+	exitCount  int         //restart count
+	crashes    []time.Time //crash times in restart window
+	restarting bool        //waiting to restart with backoff
+	failed     bool        //gave up restarting(crash looping)
+	ready      bool        //ready to serve(see cmdReady)
 }
 
 //BeforeHandle a before handler for each request
@@ -89,7 +123,7 @@ type MigrationHandle func() error
 //init application
 func init() {
 	os.Chdir(AppDir())
-	app = &App{Server: &http.Server{}, Router: httprouter.New(), runing: true, wrap: true, pattern: map[string]*Pattern{}}
+	app = &App{Server: &http.Server{}, Router: httprouter.New(), preflight: httprouter.New(), listeners: map[string]*os.File{}, runing: true, wrap: true, pattern: map[string]*Pattern{}}
 	parseCommandLine()
 	app.pool.New = func() interface{} {
 		return &Context{}
@@ -99,17 +133,39 @@ func init() {
 		Log = logs.Init(conf.Log())
 		session.Init(conf.Session())
 		lang.TransFile(conf.Trans())
+		if c := conf.JWT(); c != nil {
+			j, err := jwt.New(c)
+			if err != nil {
+				logs.Errors("jwt init failed", err)
+			} else {
+				JWT(j)
+			}
+		}
 	} else {
 		Log = logs.Init(nil)
 	}
-	app.cors = conf.CORS()
+	app.cors = newCORS(conf.CORS())
 
 	app.wrap = conf.Wrap()
 
+	workerIDNode(conf.Conf())
 	app.id = ids.New()
 
 	app.page = conf.Page()
 
+	initPolicy(conf.RBAC())
+
+	initRateLimit(conf.RateLimit())
+
+	initCache(conf.Cache())
+
+	app.timeout = conf.Timeout()
+	app.compress = conf.Compress()
+	app.etag = conf.ETag()
+	app.metrics = conf.Metrics().Enable
+	app.Server.ReadTimeout = conf.ReadTimeout()
+	app.Server.WriteTimeout = conf.WriteTimeout()
+
 	//register not found handler of router
 	app.Router.NotFound = NotFoundHandler{}
 	//register not allowed handler of router
@@ -124,8 +180,13 @@ func Before(f BeforeHandle) {
 }
 
 //Auth set the request 'authorization' handle
-func Auth(f AuthorizationHandle) {
+//challenge is the WWW-Authenticate challenge on failure(default is Bearer with realm of app config)
+func Auth(f AuthorizationHandle, challenge ...string) {
 	app.Authorization = f
+	app.challenge = ""
+	if challenge != nil {
+		app.challenge = challenge[0]
+	}
 }
 
 //After  set the request 'after' handle
@@ -138,6 +199,16 @@ func Migration(f MigrationHandle) {
 	app.Migration = f
 }
 
+//Serve serve the listener(TLS when the cert file is set), see net/http Serve
+func (app *App) Serve(l net.Listener) error {
+	app.Server.Addr = app.Addr
+	app.Server.Handler = app.Router
+	if app.CertFile != "" {
+		return app.Server.ServeTLS(l, app.CertFile, app.KeyFile)
+	}
+	return app.Server.Serve(l)
+}
+
 // ListenAndServe see net/http ListenAndServe
 func (app *App) ListenAndServe() error {
 	app.Server.Addr = app.Addr
@@ -223,6 +294,10 @@ func routerHandle(method, pattern string, fn func(ctx *Context)) *Pattern {
 
 //Router register to httpRouter
 func Router() {
+	openAPIRouter(conf.OpenAPI())
+	metricsRouter(conf.Metrics())
+	healthRouter(conf.Health())
+	debugRouter(conf.DebugRouter())
 	for _, p := range app.pattern {
 		pRef := p
 		pRef.Router()
@@ -343,8 +418,9 @@ type NotFoundHandler struct {
 
 //ServeHTTP not found handler
 func (NotFoundHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := requestLog(w, r)
 	http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-	logs.Error("not-found",
+	log.Error("not-found",
 		logs.String("url", r.RequestURI),
 		logs.String("method", r.Method),
 		logs.Int("status code", http.StatusNotFound),
@@ -358,8 +434,9 @@ type MethodNotAllowedHandler struct {
 
 //ServeHTTP method Not Allowed handler
 func (MethodNotAllowedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := requestLog(w, r)
 	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-	logs.Error("method-not-allowed",
+	log.Error("method-not-allowed",
 		logs.String("url", r.RequestURI),
 		logs.String("method", r.Method),
 		logs.Int("status code", http.StatusMethodNotAllowed),
@@ -367,35 +444,6 @@ func (MethodNotAllowedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	)
 }
 
-//MethodOptionsHandler method Options
-type MethodOptionsHandler struct {
-}
-
-//ServeHTTP method Options handler
-func (MethodOptionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	allowOrigin := r.Header.Get("Origin")
-	allowHeaders := r.Header.Get("Access-Control-Request-Headers")
-	logs.Info("options",
-		logs.String("url", r.RequestURI),
-		logs.String("origin", allowOrigin),
-		logs.String("host", r.Host),
-		logs.String("referer", r.Referer()),
-	)
-	if app.cors.AllowHeaders != "" || allowHeaders == "" {
-		allowHeaders = app.cors.AllowHeaders
-	}
-	if app.cors.AllowOrigin != "" || allowOrigin == "" {
-		allowOrigin = app.cors.AllowOrigin
-	}
-	w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
-	w.Header().Set("Access-Control-Expose-Headers", allowHeaders)
-	w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
-	w.Header().Set("Vary", allowOrigin)
-	w.Header().Set("Access-Control-Allow-Methods", app.cors.AllowMethods)
-	w.Header().Set("Access-Control-Max-Age", app.cors.MaxAge)
-	w.Header().Set("Access-Control-Allow-Credentials", app.cors.AllowCredentials)
-}
-
 // doHandle registers the handler function for the given pattern
 // in the DefaultServeMux.
 // The documentation for ServeMux explains how patterns are matched.
@@ -403,46 +451,52 @@ func doHandle(pattern *Pattern) {
 	if pattern.Fn == nil {
 		return
 	}
+	handle := pattern.chain(serve)
+	preflightHandle(pattern)
 	//app.Router.HandlerFunc(method,pattern)
 	app.Router.Handle(pattern.Method, pattern.Pattern, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		start := time.Now()
-		allowOrigin := r.Header.Get("Origin")
-		if app.cors.AllowOrigin != "" || allowOrigin == "" {
-			allowOrigin = app.cors.AllowOrigin
-		}
-		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
-		w.Header().Set("Vary", allowOrigin)
-		w.Header().Set("Access-Control-Allow-Credentials", app.cors.AllowCredentials)
+		atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		id := requestID(r)
+		w.Header().Set(httpc.RequestIDHeader, id)
+		r = r.WithContext(httpc.WithRequestID(r.Context(), id))
+		pattern.corsPolicy().actual(w, r)
 		if pattern.Pattern == "/" && r.URL.Path != pattern.Pattern {
 			w.WriteHeader(http.StatusNotFound)
 			fmt.Fprint(w, http.StatusText(http.StatusNotFound))
 			goto end
 		}
 		{
+			if app.metrics {
+				mw := &metricWriter{ResponseWriter: w}
+				w = mw
+				defer observe(pattern, mw)()
+			}
 			ctx := app.pool.Get().(*Context)
 			ctx.Reset()
+			//the ctx is still used by the overrun handle(see Timeout)
+			overrun := false
+			var cw *compressWriter
 			// defer app.pool.Put(ctx)
 			defer func() {
-				if ctx.Session != nil {
-					//commit session data
-					go ctx.Session.Commit()
-				}
-				app.pool.Put(ctx)
 				if err := recover(); err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					fmt.Fprint(w, http.StatusText(http.StatusInternalServerError))
-					panicCaller := logs.NewEntryCaller(runtime.Caller(4)).TrimmedPath()
-					logs.ErrorWithCaller("handle-panic",
-						logs.String("url", r.RequestURI),
-						logs.String("method", r.Method),
-						logs.String("caller", panicCaller),
-						logs.Any("error", err),
-						logs.String("cost", time.Since(start).String()),
-					)
+					recovered(ctx, err, start)
+				}
+				if cw != nil {
+					cw.Close()
+				}
+				if !overrun {
+					if ctx.Session != nil {
+						//commit session data
+						go session.Commit(ctx.Session)
+					}
+					app.pool.Put(ctx)
 				}
 			}()
 
 			ctx.Router = pattern
+			ctx.requestID = id
 			ctx.In = r
 			ctx.Accept = r.Header.Get("Accept")
 			if ctx.Accept == "" || strings.HasPrefix(ctx.Accept, "application/json") {
@@ -453,6 +507,11 @@ func doHandle(pattern *Pattern) {
 				ctx.KindAccept = KindAcceptYAML
 			}
 			ctx.Out = w
+			if c := pattern.compression(); c.Enable {
+				if cw = newCompressWriter(w, r, c); cw != nil {
+					ctx.Out = cw
+				}
+			}
 			ctx.Params = ps
 			ctx.NeedAuthorization = pattern.authorization
 
@@ -461,35 +520,66 @@ func doHandle(pattern *Pattern) {
 				ctx.Session = s
 			}
 
-			if pattern.authorization && app.Authorization != nil && app.Authorization(ctx) != nil {
-				w.WriteHeader(http.StatusUnauthorized)
-				fmt.Fprint(w, http.StatusText(http.StatusUnauthorized))
-				goto end
+			if d := pattern.deadline(); d > 0 {
+				overrun = serveTimeout(ctx, handle, d)
+			} else {
+				handle(ctx)
 			}
+		}
+	end:
+		access(r, start, id)
+	})
+}
 
-			if ctx.NeedAuthorization {
-				ctx.IsAuthorization = true
-			}
+//serve is the innermost handle of each request
+func serve(ctx *Context) {
+	pattern := ctx.Router
+	if !limit(ctx, false) {
+		return
+	}
 
-			if app.Before != nil && app.Before(ctx) != nil {
-				w.WriteHeader(http.StatusPreconditionFailed)
-				fmt.Fprint(w, http.StatusText(http.StatusPreconditionFailed))
-				goto end
-			}
+	if pattern.authorization && !authorize(ctx) {
+		return
+	}
+
+	if ctx.NeedAuthorization {
+		ctx.IsAuthorization = true
+	}
 
-			pattern.Fn(ctx)
+	if !limit(ctx, true) || !permit(ctx) {
+		return
+	}
 
-			if app.After != nil {
-				app.After(ctx)
-			}
-		}
-	end:
-		access(r, start)
-	})
+	if pattern.cache != nil {
+		serveCache(ctx, call)
+		return
+	}
+	call(ctx)
+}
+
+//call call the before, handle and after of request
+//the health probes skip the before and after
+func call(ctx *Context) {
+	if ctx.Router.probe {
+		ctx.Router.Fn(ctx)
+		return
+	}
+	if app.Before != nil && app.Before(ctx) != nil {
+		ctx.Out.WriteHeader(http.StatusPreconditionFailed)
+		fmt.Fprint(ctx.Out, http.StatusText(http.StatusPreconditionFailed))
+		return
+	}
+
+	ctx.Router.Fn(ctx)
+
+	if app.After != nil {
+		app.After(ctx)
+	}
 }
 
-func access(r *http.Request, start time.Time) {
+func access(r *http.Request, start time.Time, id string) {
 	logs.Info("access",
+		logs.String("requestId", id),
 		logs.String("url", r.RequestURI),
 		logs.String("method", r.Method),
 		logs.String("userAgent", r.UserAgent()),
@@ -604,7 +694,25 @@ func doRun(addr, certFile, keyFile string) error {
 	app.Addr = addr
 	app.CertFile = certFile
 	app.KeyFile = keyFile
-	err := tryRun()
+	//the listener of master is used to serve without refused connections in reload
+	l, err := inheritedListener(addr)
+	if err != nil {
+		logs.Errors("inherited listener", err)
+	}
+	//the listener of systemd socket activation
+	if l == nil {
+		l = activatedListener(addr)
+	}
+	//the sibling work processes listen the same address with SO_REUSEPORT
+	if l == nil && flagDaemon && useReusePort(conf.Conf()) && !isUnix(addr) {
+		l, err = listenReusePort(addr)
+	} else if l == nil {
+		err = tryRun()
+		//the unix socket is not supported by ListenAndServe
+		if err == nil && isUnix(addr) {
+			l, err = listen(addr, socketMode(conf.Conf()))
+		}
+	}
 
 	if err != nil {
 		logs.Error("bast listen",
@@ -619,9 +727,17 @@ func doRun(addr, certFile, keyFile string) error {
 	Router()
 
 	logs.Info("bast run", logs.String("address", app.Addr))
+	app.started = time.Now()
+	serveWork()
+	//the work processes are not notified(see newNotifier), the master notify systemd when all of them are ready
+	systemd.notify("READY=1")
+	go systemd.watch()
 
 	errMsg := ""
-	if certFile == "" {
+	if l != nil {
+		err = app.Serve(l)
+		errMsg = "serve"
+	} else if certFile == "" {
 		err = app.ListenAndServe()
 		errMsg = "listenAndServe"
 	} else {
@@ -629,6 +745,13 @@ func doRun(addr, certFile, keyFile string) error {
 		errMsg = "listenAndServeTLS"
 	}
 
+	if err == http.ErrServerClosed {
+		//wait for the in-flight requests(include the connections accepted in shutting down)
+		//the old work process of reload exit after them
+		ctx, cancel := context.WithTimeout(context.Background(), conf.Shutdown())
+		app.Server.Shutdown(ctx)
+		cancel()
+	}
 	if err != nil {
 		logs.Errors(errMsg, err)
 		logs.Sync()
@@ -664,7 +787,7 @@ func tryRun() error {
 }
 
 func doTryRun(add string) error {
-	l, err := net.Listen("tcp", add)
+	l, err := listen(add, 0)
 	if err != nil {
 		return err
 	}
@@ -690,7 +813,10 @@ func Command() bool {
 			}
 		}
 	}
-	if flagStart {
+	if flagOpenAPI != "" {
+		err = exportOpenAPI(flagOpenAPI)
+		r = false
+	} else if flagStart {
 		r, err = start()
 	} else if flagService {
 		serviceInstall()
@@ -701,6 +827,18 @@ func Command() bool {
 	} else if flagReload {
 		reload()
 		r = false
+	} else if flagStatus {
+		status()
+		r = false
+	} else if flagReloadConf {
+		controlWorks(cmdConf, nil)
+		r = false
+	} else if flagLog != "" {
+		controlWorks(cmdLog, flagLog)
+		r = false
+	} else if flagStats {
+		controlWorks(cmdStats, nil)
+		r = false
 	} else if flagDaemon {
 		doDaemon()
 	} else if isInstall {
@@ -770,17 +908,31 @@ func doStart() error {
 		logs.Info("service info", logs.String("path", path), logs.String("masterPid", pid))
 	}
 	app.cmd = []work{}
-	for _, c := range appConfs {
-		cmd := exec.Command(os.Args[0], "--daemon", "--appkey="+c.Key, "--pipe="+app.pipeName, "--conf="+path)
-		// cmd.Stdout = os.Stdout
-		// cmd.Stderr = os.Stderr
-		cmd.Dir = AppDir()
-		err := cmd.Start()
-		if err != nil {
-			logs.Errors("create child process filed", err)
-			return err
+	if err := checkIDNodes(appConfs); err != nil {
+		logs.Errors("refuse to start", err)
+		if !flagService {
+			fmt.Println("refuse to start,detail:" + err.Error())
+		}
+		return err
+	}
+	//the control pipe is listened before work processes are started, they notify master when they are ready
+	app.master = newMaster()
+	if err := app.master.serve(); err != nil {
+		logs.Errors("master pipe listen failed", err)
+	}
+	for i := range appConfs {
+		c := &appConfs[i]
+		for index, n := 0, workers(c); index < n; index++ {
+			cmd := workCommand(c, index)
+			// cmd.Stdout = os.Stdout
+			// cmd.Stderr = os.Stderr
+			err := cmd.Start()
+			if err != nil {
+				logs.Errors("create child process filed", err)
+				return err
+			}
+			app.cmd = append(app.cmd, work{key: c.Key, index: index, cmd: cmd, runing: true})
 		}
-		app.cmd = append(app.cmd, work{key: c.Key, cmd: cmd, runing: true})
 	}
 	if err := logPid(); err != nil {
 		logs.Errors("logging error log pid", err)
@@ -795,18 +947,18 @@ func startWork(index int) *exec.Cmd {
 	w := app.cmd[index]
 	c := conf.WithKey(w.key)
 	if c != nil {
-		path := conf.Path()
-		// pid := strconv.Itoa(os.Getpid())
-		cmd := exec.Command(os.Args[0], "--daemon", "--appkey="+c.Key, "--pipe="+app.pipeName, "--conf="+path)
+		cmd := workCommand(c, w.index)
 		// cmd.StdinPipe()
+		restarts := w.exitCount + 1
+		cmd.Env = append(cmd.Env, workerRestartsEnv+"="+strconv.Itoa(restarts))
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-		cmd.Dir = AppDir()
 		err := cmd.Start()
 		if err != nil {
 			return nil
 		}
-		app.cmd[index] = work{key: c.Key, cmd: cmd, runing: true}
+		metrics.WorkerRestarts.WithLabelValues(c.Key).Inc()
+		app.cmd[index] = work{key: c.Key, index: w.index, cmd: cmd, runing: true, exitCount: restarts, crashes: w.crashes}
 		logPid()
 		return cmd
 
@@ -814,38 +966,77 @@ func startWork(index int) *exec.Cmd {
 	return nil
 }
 
-//checkWorkProcess check work process stat
+//checkWorkProcess check work process stat, restart the crashed work processes(see restart.go)
+//and handle the control requests(see control.go) and SIGHUP of reload
 func checkWorkProcess() {
-	c := make(chan struct{})
-	lg := len(app.cmd)
-	l := 0
-	for i := 0; i < lg; i++ {
-		w := &app.cmd[i]
-		if w.runing {
-			go func(wc *work) {
-				w.cmd.Wait()
-				c <- struct{}{}
-			}(w)
-			l++
+	m := app.master
+	for i := range app.cmd {
+		if w := &app.cmd[i]; w.runing {
+			m.wait(w.cmd)
 		}
 	}
-	for i := 0; i < lg; i++ {
-		<-c
-		w := &app.cmd[i]
-		exitCode := ""
-		if w.cmd.ProcessState != nil {
-			exitCode = strconv.Itoa(w.cmd.ProcessState.ExitCode())
-		}
-		if flagService {
-			logs.Error("has work process exited", logs.String("exitCode", exitCode))
-		} else {
-			fmt.Println("has work process exited,exit code=" + exitCode)
-		}
-		w.runing = false
-		if !app.runing {
-			break
+	hup := make(chan os.Signal, 1)
+	if handoff() {
+		signal.Notify(hup, syscall.SIGHUP)
+	}
+	//the master is stopped by signal when its control pipe is not working(see stopWorks)
+	quit := make(chan os.Signal, 1)
+	if !flagService {
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	}
+	//the pings of systemd watchdog are sent by the check loop, they stop when it's blocked
+	var watchdog <-chan time.Time
+	if systemd.watchdog > 0 {
+		t := time.NewTicker(systemd.watchdog)
+		defer t.Stop()
+		watchdog = t.C
+	}
+	for app.runing && runningWorks()+restartings() > 0 {
+		m.notifyReady()
+		select {
+		case <-hup:
+			m.reload()
+		case <-quit:
+			m.stop()
+		case <-watchdog:
+			m.watchdog()
+		case f := <-m.calls:
+			f()
+		case index := <-m.restarts:
+			m.started(index)
+		case pid := <-m.expired:
+			m.reloads.abort(pid, "ready timeout")
+		case cmd := <-m.exits:
+			pid := cmd.Process.Pid
+			if m.reloads.abort(pid, "exited") {
+				continue
+			}
+			w := workOf(cmd)
+			if w == nil {
+				//the old work process of reload
+				logs.Info("old work process exited", logs.Int("pid", pid))
+				continue
+			}
+			exitCode := ""
+			if cmd.ProcessState != nil {
+				exitCode = strconv.Itoa(cmd.ProcessState.ExitCode())
+			}
+			if flagService {
+				logs.Error("has work process exited", logs.String("exitCode", exitCode))
+			} else {
+				fmt.Println("has work process exited,exit code=" + exitCode)
+			}
+			w.runing = false
+			logPid()
+			m.restart(workIndex(w), cmd.ProcessState == nil || !cmd.ProcessState.Success())
 		}
 	}
+	close(m.quit)
+	signal.Stop(hup)
+	signal.Stop(quit)
+	for _, f := range app.listeners {
+		f.Close()
+	}
 	if flagService {
 		logs.Error("exited check work process")
 	} else {
@@ -854,6 +1045,37 @@ func checkWorkProcess() {
 	clear()
 }
 
+//runningWorks return the count of running work processes
+func runningWorks() int {
+	n := 0
+	for i := range app.cmd {
+		if app.cmd[i].runing {
+			n++
+		}
+	}
+	return n
+}
+
+//workIndex return the index of work in app.cmd
+func workIndex(w *work) int {
+	for i := range app.cmd {
+		if &app.cmd[i] == w {
+			return i
+		}
+	}
+	return -1
+}
+
+//workOf return the current work of cmd, nil is not found(such as: the old one of reload)
+func workOf(cmd *exec.Cmd) *work {
+	for i := range app.cmd {
+		if app.cmd[i].cmd == cmd {
+			return &app.cmd[i]
+		}
+	}
+	return nil
+}
+
 type daemonExecutable struct {
 }
 
@@ -871,28 +1093,58 @@ func (e *daemonExecutable) Run() {
 }
 
 func reload() {
-	pids := getWorkPids()
-	for _, pid := range pids {
-		sendSignal(syscall.SIGINT, pid)
+	//the master start new work processes with the same listeners and stop the old ones when they are ready
+	if ok, err := reloadMaster(); ok {
+		return
+	} else if err != nil {
+		logs.Errors("reload master failed, restart it", err)
 	}
+	//the master is stopped before the new one is started(such as: on windows)
+	stopWorks()
 	start()
 }
 
 func serviceStop() {
-	pids := getWorkPids()
-	for _, pid := range pids {
-		sendSignal(syscall.SIGINT, pid)
-	}
+	systemd.notify("STOPPING=1")
+	var wg sync.WaitGroup
+	for _, pid := range getWorkPids() {
+		wg.Add(1)
+		go func(pid int) {
+			defer wg.Done()
+			stopWork(pid)
+		}(pid)
+	}
+	wg.Wait()
 	clear()
 }
 
 func stop() {
+	stopWorks()
+	os.Exit(0)
+}
+
+//stopWorks stop the master and work processes, the master stop work processes gracefully by control pipe(include windows).
+//the master is stopped by signal first when it's not responding, so it doesn't restart the work processes which are signalled
+func stopWorks() {
 	pids := getWorkPids()
+	mpid := getMasterPidWithFile()
+	if mpid == os.Getpid() {
+		mpid = 0
+	}
+	if err := callMaster(cmdStop, nil, nil); err != nil && mpid > 0 {
+		logs.Errors("stop master by pipe failed", err)
+		if err := sendSignal(syscall.SIGINT, mpid); err != nil {
+			logs.Errors("stop master by signal failed", err)
+		}
+	}
+	if mpid > 0 && !waitProcess(mpid, conf.Shutdown()+controlTimeout) {
+		logs.Error("master is not exited", logs.Int("pid", mpid))
+	}
 	for _, pid := range pids {
-		sendSignal(syscall.SIGINT, pid)
+		if processAlive(pid) {
+			sendSignal(syscall.SIGINT, pid)
+		}
 	}
-	time.Sleep(200 * time.Millisecond)
-	os.Exit(0)
 }
 
 //AppDir app path
@@ -915,7 +1167,7 @@ func sendSignal(sig os.Signal, pid int) error {
 		return err
 	}
 	if runtime.GOOS == "windows" {
-		//TO DO  use pipe
+		//the graceful stop is requested by control pipe(see stopWork)
 		pro.Kill()
 	} else {
 		err = pro.Signal(sig)
@@ -968,7 +1220,7 @@ func uninstall() {
 }
 
 func signalListen() {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	defer close(c)
 	signal.Notify(c)
 	for {
@@ -1046,6 +1298,9 @@ func getMasterPidWithFile() int {
 //getWorkPids work pids
 func getWorkPids() []int {
 	pids := getWorkPidsFormMemory()
+	if pids == nil || len(pids) <= 0 {
+		pids = getWorkPidsFormMaster()
+	}
 	if pids == nil || len(pids) <= 0 {
 		pids = getWorkPidsFormFile()
 	}
@@ -1067,6 +1322,21 @@ func getWorkPidsFormMemory() []int {
 	return pids
 }
 
+//getWorkPidsFormMaster get work pids form the status of running master
+func getWorkPidsFormMaster() []int {
+	s := &MasterStatus{}
+	if err := callMaster(cmdStatus, nil, s); err != nil {
+		return nil
+	}
+	pids := []int{}
+	for _, w := range s.Works {
+		if w.Runing && w.Pid > 0 {
+			pids = append(pids, w.Pid)
+		}
+	}
+	return pids
+}
+
 //getWorkPidsFormFile get work pids form the file
 func getWorkPidsFormFile() []int {
 	pidPath := os.Args[0] + ".pid"
@@ -1105,6 +1375,18 @@ func Shutdown(ctx context.Context) error {
 	if cancel != nil {
 		defer cancel()
 	}
+	systemd.notify("STOPPING=1")
+	//flip the readiness to not-ready, the load balancers drain the instance before closing connections
+	health.drain()
+	if d := conf.Health().Drain; d > 0 {
+		select {
+		case <-time.After(time.Duration(d) * time.Millisecond):
+		case <-ctx.Done():
+		}
+	}
+	if app.debugServer != nil {
+		app.debugServer.Shutdown(ctx)
+	}
 	app.Server.SetKeepAlivesEnabled(false)
 	return app.Server.Shutdown(ctx)
 }
@@ -1194,6 +1476,9 @@ func clear() {
 		return
 	}
 	isClear = true
+	if app.pipe != nil {
+		app.pipe.Close()
+	}
 	logs.Clear()
 	removePid()
 	if app.registry != nil {
@@ -1218,7 +1503,7 @@ func parseCommandLine() {
 	if isInstall {
 		flagDaemon = false
 	}
-	if flagStop || flagReload || flagDaemon || isInstall || isUninstall || flagService {
+	if flagStop || flagReload || flagStatus || flagReloadConf || flagLog != "" || flagStats || flagDaemon || isInstall || isUninstall || flagService || flagOpenAPI != "" {
 		flagStart = false
 	}
 	if flagService {
@@ -1264,6 +1549,11 @@ Use "{{.CommandPath}} [command] --help" for more information about a command.{{e
 	cmd.Flags().BoolVarP(&flagStart, "start", "s", flagStart, "run in background")
 	cmd.Flags().BoolVarP(&flagStop, "stop", "e", flagStop, "graceful for stop")
 	cmd.Flags().BoolVarP(&flagReload, "reload", "r", flagReload, "graceful for reload")
+	cmd.Flags().BoolVar(&flagStatus, "status", flagStatus, "show status of master and work processes")
+	cmd.Flags().BoolVar(&flagJSON, "json", flagJSON, "show status as json")
+	cmd.Flags().BoolVar(&flagReloadConf, "reload-conf", flagReloadConf, "reload config of work processes without restarting them")
+	cmd.Flags().StringVar(&flagLog, "log", flagLog, "set log level of work processes(such as: debug)")
+	cmd.Flags().BoolVar(&flagStats, "stats", flagStats, "show runtime stats of work processes")
 	cmd.Flags().BoolVarP(&isMigration, "migration", "m", isMigration, "migration or initial system")
 	cmd.Flags().StringVarP(&flagConf, "conf", "c", flagConf, "config path(default is ./config.conf)")
 	cmd.Flags().BoolVarP(&isInstall, "install", "i", isInstall, "install to service")
@@ -1276,6 +1566,7 @@ Use "{{.CommandPath}} [command] --help" for more information about a command.{{e
 	cmd.Flags().StringVarP(&flagAppKey, "appkey", "k", flagAppKey, "app key")
 	cmd.Flags().StringVarP(&flagPipe, "pipe", "p", flagPipe, "pipe name")
 	cmd.Flags().IntVar(&flagPid, "pid", flagPid, "")
+	cmd.Flags().StringVar(&flagOpenAPI, "openapi", flagOpenAPI, "export OpenAPI document to file(.json or .yaml)")
 	cmd.SetUsageTemplate(usageTemplate)
 	err := cmd.Execute()
 	if err != nil {
@@ -3,14 +3,101 @@
 package bast
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/axfor/bast/auth/jwt"
+	"github.com/axfor/bast/cache"
+	"github.com/axfor/bast/conf"
 	"github.com/axfor/bast/httpc"
+	"github.com/axfor/bast/ids"
+	"github.com/axfor/bast/logs"
+	"github.com/axfor/bast/metrics"
+	"github.com/axfor/bast/pipe"
+	"github.com/axfor/bast/ratelimit"
+	"github.com/axfor/bast/service"
+	"github.com/axfor/bast/session/serde"
+	"github.com/julienschmidt/httprouter"
 )
 
 var appStarted bool
 
+//serveRequest serve the request by the router of app
+func serveRequest(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, r)
+	return w
+}
+
+//request serve the request of method and url with the headers(name and value pairs)
+func request(method, url string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, url, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	return serveRequest(r)
+}
+
+//get serve the GET request of url with the headers(name and value pairs)
+func get(url string, headers ...string) *httptest.ResponseRecorder {
+	return request(http.MethodGet, url, headers...)
+}
+
+//mark return a middleware which append the tag to the trace
+func mark(trace *string, tag string) Middleware {
+	return func(next Handle) Handle {
+		return func(ctx *Context) {
+			*trace += tag
+			next(ctx)
+		}
+	}
+}
+
+//authSchemes register the "key"(X-Key: k) and "token"(X-Token: t) authorization schemes of tests
+func authSchemes() {
+	AuthScheme("key", func(ctx *Context) error {
+		if ctx.In.Header.Get("X-Key") != "k" {
+			return errors.New("invalid key")
+		}
+		return nil
+	}, `Key realm="bast"`)
+	AuthScheme("token", func(ctx *Context) error {
+		if ctx.In.Header.Get("X-Token") != "t" {
+			return errors.New("invalid token")
+		}
+		return nil
+	})
+}
+
+//freshRouter use the fresh routers and patterns of app until the test is finished
+//so the test can register the same paths again(such as: go test -count=2)
+func freshRouter(t *testing.T) {
+	router, preflight, pattern := app.Router, app.preflight, app.pattern
+	app.Router, app.preflight, app.pattern = httprouter.New(), httprouter.New(), map[string]*Pattern{}
+	app.Router.NotFound, app.Router.MethodNotAllowed, app.Router.GlobalOPTIONS = router.NotFound, router.MethodNotAllowed, router.GlobalOPTIONS
+	t.Cleanup(func() {
+		app.Router, app.preflight, app.pattern = router, preflight, pattern
+	})
+}
+
 func Benchmark_QPS(t *testing.B) {
 	if !appStarted {
 		startApp()
@@ -50,6 +137,1414 @@ func TestBastApp(t *testing.T) {
 	}
 }
 
+func TestMiddleware(t *testing.T) {
+	freshRouter(t)
+	trace := ""
+	stop := func(next Handle) Handle {
+		return func(ctx *Context) {
+			ctx.StatusCode(http.StatusForbidden)
+		}
+	}
+	Use(mark(&trace, "a"))
+	defer func() {
+		app.middleware = nil
+	}()
+	Get("/middleware", func(ctx *Context) {
+		trace += "h"
+		ctx.Says("ok")
+	}).Use(mark(&trace, "b"), mark(&trace, "c")).Router()
+	Get("/middleware/stop", func(ctx *Context) {
+		trace += "h"
+	}).Use(stop).Router()
+
+	w := get("/middleware")
+	if trace != "abch" || w.Body.String() != "ok" {
+		t.Errorf("trace=%s body=%s", trace, w.Body.String())
+	}
+
+	trace = ""
+	w = get("/middleware/stop")
+	if trace != "a" || w.Code != http.StatusForbidden {
+		t.Errorf("trace=%s code=%d", trace, w.Code)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	freshRouter(t)
+	trace := ""
+	api := Group("/api/", mark(&trace, "g")).Param("api").Registry("API")
+	v1 := api.Group("v1", mark(&trace, "v"))
+	v1.Get("/", func(ctx *Context) {
+		ctx.Says(ctx.Router.Pattern)
+	}).Router()
+	p := v1.Get("/users/:id", func(ctx *Context) {
+		ctx.Says(ctx.GetParam("id"))
+	}).Use(mark(&trace, "p")).Router()
+
+	if p.Pattern != "/api/v1/users/:id" || p.Parameter != "api" || p.Service != "API" || !p.publish {
+		t.Errorf("pattern=%s param=%v service=%s", p.Pattern, p.Parameter, p.Service)
+	}
+
+	w := get("/api/v1/users/7")
+	if trace != "gvp" || w.Body.String() != "7" {
+		t.Errorf("trace=%s body=%s", trace, w.Body.String())
+	}
+
+	w = get("/api/v1")
+	if w.Body.String() != "/api/v1" {
+		t.Errorf("body=%s", w.Body.String())
+	}
+}
+
+func TestAuthScheme(t *testing.T) {
+	freshRouter(t)
+	authSchemes()
+	Get("/auth/any", func(ctx *Context) {
+		ctx.Says("ok")
+	}).Auth("key", "token").Router()
+	Get("/auth/all", func(ctx *Context) {
+		ctx.Says("ok")
+	}).AuthAll("key", "token").Router()
+
+
+	w := get("/auth/any")
+	if w.Code != http.StatusUnauthorized || len(w.Header().Values("WWW-Authenticate")) != 2 {
+		t.Errorf("code=%d challenge=%v", w.Code, w.Header().Values("WWW-Authenticate"))
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("content-type=%s", w.Header().Get("Content-Type"))
+	}
+	w = get("/auth/any", "X-Token", "t")
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("code=%d body=%s", w.Code, w.Body.String())
+	}
+	w = get("/auth/all", "X-Token", "t")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Key realm="bast"` {
+		t.Errorf("code=%d challenge=%v", w.Code, w.Header().Values("WWW-Authenticate"))
+	}
+	w = get("/auth/all", "X-Token", "t", "X-Key", "k")
+	if w.Code != http.StatusOK {
+		t.Errorf("code=%d", w.Code)
+	}
+
+	//the global 'authorization' handle
+	handle, challenge := app.Authorization, app.challenge
+	defer func() {
+		app.Authorization, app.challenge = handle, challenge
+	}()
+	Auth(func(ctx *Context) error {
+		return errors.New("denied")
+	})
+	Get("/auth/global", func(ctx *Context) {
+		ctx.Says("ok")
+	}).Auth().Router()
+	w = get("/auth/global")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Bearer realm="`+conf.Realm()+`"` {
+		t.Errorf("code=%d challenge=%v", w.Code, w.Header().Values("WWW-Authenticate"))
+	}
+	Auth(func(ctx *Context) error {
+		return errors.New("denied")
+	}, `Basic realm="admin"`)
+	w = get("/auth/global")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Basic realm="admin"` {
+		t.Errorf("code=%d challenge=%v", w.Code, w.Header().Values("WWW-Authenticate"))
+	}
+}
+
+func TestJWT(t *testing.T) {
+	freshRouter(t)
+	j, err := jwt.New(&jwt.Conf{Secret: "bast"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	JWT(j)
+	defer func() {
+		app.jwt = nil
+	}()
+	token := ""
+	Post("/jwt/sign", func(ctx *Context) {
+		token, _ = ctx.SignJWT(jwt.Claims{"sub": "bast"})
+	}).Router()
+	Get("/jwt/me", func(ctx *Context) {
+		ctx.Says(ctx.Claims().Subject())
+	}).Auth("jwt").Router()
+
+	request(http.MethodPost, "/jwt/sign")
+	if token == "" {
+		t.Fatal("sign token failed")
+	}
+	r := httptest.NewRequest(http.MethodGet, "/jwt/me", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := serveRequest(r)
+	if w.Body.String() != "bast" {
+		t.Errorf("code=%d body=%s", w.Code, w.Body.String())
+	}
+
+	w = get("/jwt/me")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("code=%d", w.Code)
+	}
+}
+
+func TestRBAC(t *testing.T) {
+	freshRouter(t)
+	initPolicy(&conf.RBACConf{
+		DenyDefault: true,
+		Roles:       map[string][]string{"editor": {"post:write"}},
+		Rules:       []conf.RBACRule{{Method: http.MethodDelete, Pattern: "/rbac/posts", Roles: []string{"admin"}}},
+	})
+	defer initPolicy(&conf.RBACConf{})
+	roles := []string{}
+	AuthScheme("rbac", func(ctx *Context) error {
+		ctx.SetPrincipal(&Principal{ID: "1", Roles: roles})
+		return nil
+	})
+	ok := func(ctx *Context) {
+		ctx.Says("ok")
+	}
+	Get("/rbac/posts", ok).Auth("rbac").Roles("editor", "admin")
+	Post("/rbac/posts", ok).Auth("rbac").Permissions("post:write")
+	Delete("/rbac/posts", ok).Auth("rbac")
+	Put("/rbac/posts", ok).Auth("rbac")
+	for _, m := range []string{http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodPut} {
+		app.pattern[m+"/rbac/posts"].Router()
+	}
+
+	if c := request(http.MethodGet, "/rbac/posts").Code; c != http.StatusForbidden {
+		t.Errorf("code=%d", c)
+	}
+	roles = []string{"editor"}
+	if c := request(http.MethodGet, "/rbac/posts").Code; c != http.StatusOK {
+		t.Errorf("code=%d", c)
+	}
+	if c := request(http.MethodPost, "/rbac/posts").Code; c != http.StatusOK {
+		t.Errorf("code=%d", c)
+	}
+	if c := request(http.MethodDelete, "/rbac/posts").Code; c != http.StatusForbidden {
+		t.Errorf("code=%d", c)
+	}
+	//deny by default
+	roles = []string{"admin"}
+	if c := request(http.MethodPost, "/rbac/posts").Code; c != http.StatusForbidden {
+		t.Errorf("code=%d", c)
+	}
+	if c := request(http.MethodDelete, "/rbac/posts").Code; c != http.StatusOK {
+		t.Errorf("code=%d", c)
+	}
+	if c := request(http.MethodPut, "/rbac/posts").Code; c != http.StatusForbidden {
+		t.Errorf("code=%d", c)
+	}
+}
+
+func TestSessionPrincipal(t *testing.T) {
+	want := &Principal{ID: "1", Roles: []string{"editor"}, Permissions: []string{"post:write"}}
+	//the serialising session engine(see session/serde)
+	data, err := serde.Encode(map[string]interface{}{PrincipalKey: want})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := serde.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := sessionPrincipal(m[PrincipalKey]); p == nil || p.ID != "1" || !p.HasRole("editor") {
+		t.Fatal(p)
+	}
+	//the json session engine decode the principal as map
+	data, _ = json.Marshal(map[string]interface{}{PrincipalKey: want})
+	m = map[string]interface{}{}
+	json.Unmarshal(data, &m)
+	if p := sessionPrincipal(m[PrincipalKey]); p == nil || p.ID != "1" || !p.HasRole("editor") || len(p.Permissions) != 1 {
+		t.Fatal(p)
+	}
+	if p := sessionPrincipal(map[string]interface{}{"name": "x"}); p != nil {
+		t.Fatal(p)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	freshRouter(t)
+	authSchemes()
+	type user struct {
+		Name string `json:"name" v:"required|min:1"`
+	}
+	Post("/openapi/users/:id", func(ctx *Context) {}).
+		Request(user{}).Response([]user{}).Summary("create user").Nickname("createUser").
+		Auth("key", "token")
+	doc := OpenAPI()
+	item, ok := doc.Paths["/openapi/users/{id}"]
+	if !ok || item.Post == nil {
+		t.Fatal(doc.Paths)
+	}
+	op := item.Post
+	if op.OperationID != "createUser" || len(op.Parameters) != 1 || op.RequestBody == nil || len(op.Security) != 2 {
+		t.Errorf("%+v", op)
+	}
+	if op.Responses["200"].Content["application/json"].Schema.Properties["data"].Items.Ref != "#/components/schemas/user" {
+		t.Errorf("%+v", op.Responses["200"])
+	}
+	if _, ok := doc.Components.SecuritySchemes["key"]; !ok {
+		t.Error(doc.Components.SecuritySchemes)
+	}
+}
+
+func TestOpenAPIUI(t *testing.T) {
+	freshRouter(t)
+	authSchemes()
+	type item struct {
+		ID int64 `json:"id"`
+	}
+	Get("/openapi/items", func(ctx *Context) {}).PageResponse(item{}).Router()
+	openAPIRouter(&conf.OpenAPIConf{UI: "/docs/", Auth: []string{"key"}})
+	app.pattern[http.MethodGet+"/docs/*filepath"].Router()
+	if w := get("/docs/"); w.Code != http.StatusUnauthorized {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	if w := get("/docs/", "X-Key", "k"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "openapi.json") {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	w := get("/docs/openapi.json", "X-Key", "k")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"/openapi/items"`) || strings.Contains(w.Body.String(), `"/docs/{filepath}"`) {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	op := OpenAPI().Paths["/openapi/items"].Get
+	if len(op.Parameters) != 3 || op.Responses["200"].Content["application/json"].Schema.Properties["total"] == nil {
+		t.Errorf("%+v", op)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	freshRouter(t)
+	Get("/ratelimit", func(ctx *Context) {
+		ctx.Says("ok")
+	}).RateLimit(ratelimit.Policy{Limit: 2, Window: 60}).Router()
+	store := app.limitStore
+	app.limitStore = ratelimit.NewMemory()
+	defer func() { app.limitStore = store }()
+	do := func(ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/ratelimit", nil)
+		r.RemoteAddr = ip + ":1234"
+		return serveRequest(r)
+	}
+	for i := 0; i < 2; i++ {
+		if w := do("192.0.2.1"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Remaining") != strconv.Itoa(1-i) {
+			t.Fatal(i, w.Code, w.Header())
+		}
+	}
+	w := do("192.0.2.1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" || w.Header().Get("RateLimit-Limit") != "2" {
+		t.Fatal(w.Code, w.Header())
+	}
+	if w := do("192.0.2.2"); w.Code != http.StatusOK {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	freshRouter(t)
+	canceled := make(chan bool, 1)
+	Get("/timeout/slow", func(ctx *Context) {
+		select {
+		case <-ctx.Context().Done():
+			canceled <- true
+		case <-time.After(time.Second):
+			canceled <- false
+		}
+		//the handle overrun the deadline
+		time.Sleep(50 * time.Millisecond)
+		ctx.Says("late")
+	}).Timeout(20 * time.Millisecond).Router()
+	Get("/timeout/fast", func(ctx *Context) {
+		ctx.Status(http.StatusAccepted)
+		ctx.Says("ok")
+	}).Timeout(time.Second).Router()
+
+	w := get("/timeout/slow")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), strconv.Itoa(SerTry)) {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	if !<-canceled {
+		t.Error("context is not canceled")
+	}
+	w = get("/timeout/fast")
+	if w.Code != http.StatusAccepted || w.Body.String() != "ok" {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	//the flushed response is streamed, so only the context is canceled when it's expired
+	streamed := make(chan error, 1)
+	Get("/timeout/stream", func(ctx *Context) {
+		if _, _, err := ctx.Out.(http.Hijacker).Hijack(); err == nil || err.Error() != "not support http hijacker" {
+			t.Error(err)
+		}
+		ctx.Out.Write([]byte("a"))
+		ctx.Out.(http.Flusher).Flush()
+		<-ctx.Context().Done()
+		_, err := ctx.Out.Write([]byte("b"))
+		streamed <- err
+	}).Timeout(20 * time.Millisecond).Router()
+	w = get("/timeout/stream")
+	//the write after the context is canceled is failed when the timeout is handled before it
+	want := "a"
+	if err := <-streamed; err == nil {
+		want = "ab"
+	} else if err != http.ErrHandlerTimeout {
+		t.Error(err)
+	}
+	if w.Code != http.StatusOK || w.Body.String() != want || !w.Flushed {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestRecover(t *testing.T) {
+	freshRouter(t)
+	p := Get("/recover", func(ctx *Context) {
+		panic("boom")
+	}).Router()
+	r := httptest.NewRequest(http.MethodGet, "/recover", nil)
+	r.Header.Set("Accept", "application/xml")
+	w := serveRequest(r)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "<code>0</code>") {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	var stack []byte
+	Recover(func(ctx *Context, err interface{}, s []byte) {
+		stack = s
+		ctx.Status(http.StatusBadGateway)
+		ctx.Says(fmt.Sprint(err))
+	})
+	defer Recover(nil)
+	w = get("/recover")
+	if w.Code != http.StatusBadGateway || w.Body.String() != "boom" || !strings.Contains(string(stack), "TestRecover") {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	//the caller is the handle, the frames of bast are skipped(include the goroutine of timeout)
+	if c := panicCaller(stack); !strings.Contains(c, "bast_test.go:") {
+		t.Error(c)
+	}
+	Get("/recover/timeout", func(ctx *Context) {
+		panic("boom")
+	}).Timeout(time.Second).Router()
+	stack = nil
+	request(http.MethodGet, "/recover/timeout")
+	if c := panicCaller(stack); !strings.Contains(c, "bast_test.go:") {
+		t.Error(c)
+	}
+	if p.Panics() != 2 || PanicCounts()["GET /recover"] != 2 {
+		t.Error(PanicCounts())
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	freshRouter(t)
+	var id, forward string
+	Get("/requestid", func(ctx *Context) {
+		id = ctx.RequestID()
+		forward = ctx.HTTPClient(http.MethodGet, "http://127.0.0.1/").Req.Header.Get("X-Request-ID")
+		ctx.Log().Info("request id")
+	}).Router()
+	w := get("/requestid")
+	if id == "" || w.Header().Get("X-Request-ID") != id || forward != id {
+		t.Fatal(id, forward, w.Header())
+	}
+	r := httptest.NewRequest(http.MethodGet, "/requestid", nil)
+	r.Header.Set("X-Request-ID", "abc-123")
+	w = serveRequest(r)
+	if id != "abc-123" || w.Header().Get("X-Request-ID") != id || forward != id {
+		t.Fatal(id, forward, w.Header())
+	}
+	//the requests which are not handled by routes
+	for _, h := range []http.Handler{NotFoundHandler{}, MethodNotAllowedHandler{}, MethodOptionsHandler{}} {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Header().Get("X-Request-ID") != "abc-123" {
+			t.Error(w.Header())
+		}
+	}
+	if LogOf(httpc.WithRequestID(context.Background(), "abc-123")) == nil || LogOf(context.Background()) == nil {
+		t.Error("request log is nil")
+	}
+}
+
+func TestCompress(t *testing.T) {
+	freshRouter(t)
+	file := filepath.Join(t.TempDir(), "bast.txt")
+	if err := ioutil.WriteFile(file, []byte(strings.Repeat("bast\n", 1024)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Get("/compress/big", func(ctx *Context) {
+		ctx.JSON(strings.Repeat("bast", 1024))
+	}).Compress()
+	Get("/compress/small", func(ctx *Context) {
+		ctx.JSON("bast")
+	}).Compress()
+	Get("/compress/file", func(ctx *Context) {
+		ctx.SendFile(file)
+	}).Compress(&conf.CompressConf{Types: []string{"text/*"}})
+	Get("/compress/off", func(ctx *Context) {
+		ctx.JSON(strings.Repeat("bast", 1024))
+	}).Uncompress()
+	for _, p := range []string{"/compress/big", "/compress/small", "/compress/file", "/compress/off"} {
+		app.pattern[http.MethodGet+p].Router()
+	}
+	w := get("/compress/big", "Accept-Encoding", "deflate;q=0.5, gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" || !strings.Contains(strings.Join(w.Header().Values("Vary"), ","), "Accept-Encoding") {
+		t.Fatal(w.Header())
+	}
+	gr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(gr)
+	if !strings.Contains(string(data), "bastbast") {
+		t.Fatal(string(data))
+	}
+	if w := get("/compress/big", "Accept-Encoding", "deflate"); w.Header().Get("Content-Encoding") != "deflate" {
+		t.Error(w.Header())
+	}
+	if w := get("/compress/big", "Accept-Encoding", "identity"); w.Header().Get("Content-Encoding") != "" {
+		t.Error(w.Header())
+	}
+	if w := get("/compress/small", "Accept-Encoding", "gzip"); w.Header().Get("Content-Encoding") != "" || !strings.Contains(w.Body.String(), "bast") {
+		t.Error(w.Header(), w.Body.String())
+	}
+	if w := get("/compress/file", "Accept-Encoding", "gzip"); w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Content-Length") != "" {
+		t.Error(w.Header())
+	}
+	if w := get("/compress/off", "Accept-Encoding", "gzip"); w.Header().Get("Content-Encoding") != "" {
+		t.Error(w.Header())
+	}
+}
+
+func TestETag(t *testing.T) {
+	freshRouter(t)
+	modified := time.Now().Add(-time.Hour)
+	Get("/etag/hash", func(ctx *Context) {
+		ctx.JSON("bast")
+	}).ETag()
+	Get("/etag/version", func(ctx *Context) {
+		ctx.ETag("v2")
+		ctx.XML("bast")
+	})
+	Put("/etag/version", func(ctx *Context) {
+		if !ctx.CheckPrecondition("v2", modified) {
+			return
+		}
+		ctx.JSON("ok")
+	})
+	for _, k := range []string{http.MethodGet + "/etag/hash", http.MethodGet + "/etag/version", http.MethodPut + "/etag/version"} {
+		app.pattern[k].Router()
+	}
+	w := request(http.MethodGet, "/etag/hash")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatal(w.Code, w.Header())
+	}
+	if w := request(http.MethodGet, "/etag/hash", "If-None-Match", `"x", `+etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Error(w.Code, w.Body.String())
+	}
+	if w := request(http.MethodGet, "/etag/version", "If-None-Match", `"v1"`); w.Code != http.StatusOK || w.Header().Get("ETag") != `"v2"` {
+		t.Error(w.Code, w.Header())
+	}
+	if w := request(http.MethodGet, "/etag/version", "If-None-Match", `W/"v2"`); w.Code != http.StatusNotModified {
+		t.Error(w.Code)
+	}
+	if w := request(http.MethodPut, "/etag/version", "If-Match", `"v2"`); w.Code != http.StatusOK || w.Header().Get("ETag") != "" {
+		t.Error(w.Code, w.Header())
+	}
+	if w := request(http.MethodPut, "/etag/version", "If-Match", `"v1"`); w.Code != http.StatusPreconditionFailed || !strings.Contains(w.Body.String(), strconv.Itoa(SerMustFailed)) {
+		t.Error(w.Code, w.Body.String())
+	}
+	if w := request(http.MethodPut, "/etag/version", "If-Match", `W/"v2"`); w.Code != http.StatusPreconditionFailed {
+		t.Error(w.Code)
+	}
+	if w := request(http.MethodPut, "/etag/version", "If-Unmodified-Since", modified.Add(-time.Minute).UTC().Format(http.TimeFormat)); w.Code != http.StatusPreconditionFailed {
+		t.Error(w.Code)
+	}
+	if w := request(http.MethodPut, "/etag/version", "If-Unmodified-Since", time.Now().UTC().Format(http.TimeFormat)); w.Code != http.StatusOK {
+		t.Error(w.Code)
+	}
+}
+
+func TestCache(t *testing.T) {
+	freshRouter(t)
+	store := app.cacheStore
+	app.cacheStore = cache.NewMemory(0)
+	defer func() { app.cacheStore = store }()
+	calls := int32(0)
+	Get("/cache/users", func(ctx *Context) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		ctx.CacheTags("user:" + ctx.GetString("id"))
+		ctx.ETag("v1")
+		ctx.JSON(ctx.GetString("id"))
+	}).Cache(time.Minute).CacheTags("users")
+	Get("/cache/nostore", func(ctx *Context) {
+		atomic.AddInt32(&calls, 1)
+		ctx.Out.Header().Set("Cache-Control", "no-store")
+		ctx.JSON("bast")
+	}).Cache(time.Minute)
+	for _, p := range []string{"/cache/users", "/cache/nostore"} {
+		app.pattern[http.MethodGet+p].Router()
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := get("/cache/users?id=1&a=b"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "1") {
+				t.Error(w.Code, w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatal("stampede", n)
+	}
+	w := get("/cache/users?a=b&id=1")
+	if w.Header().Get("X-Cache") != "HIT" || w.Header().Get("ETag") != `"v1"` || w.Header().Get(httpc.RequestIDHeader) == "" || atomic.LoadInt32(&calls) != 1 {
+		t.Fatal(w.Header())
+	}
+	if w := get("/cache/users?id=1&a=b", "If-None-Match", `"v1"`); w.Code != http.StatusNotModified {
+		t.Error(w.Code)
+	}
+	if w := get("/cache/users?id=1&a=b", "Accept", "application/xml"); w.Header().Get("X-Cache") != "MISS" {
+		t.Error(w.Header())
+	}
+	if w := get("/cache/users?id=1&a=b", "Accept-Language", "zh-CN"); w.Header().Get("X-Cache") != "MISS" {
+		t.Error(w.Header())
+	}
+	get("/cache/users?id=2")
+	calls = 0
+	if err := InvalidateCache("user:1"); err != nil {
+		t.Fatal(err)
+	}
+	if w := get("/cache/users?id=1&a=b"); w.Header().Get("X-Cache") != "MISS" {
+		t.Error(w.Header())
+	}
+	if w := get("/cache/users?id=2"); w.Header().Get("X-Cache") != "HIT" {
+		t.Error(w.Header())
+	}
+	InvalidateCache("users")
+	if w := get("/cache/users?id=2"); w.Header().Get("X-Cache") != "MISS" {
+		t.Error(w.Header())
+	}
+	get("/cache/nostore")
+	if w := get("/cache/nostore"); w.Header().Get("X-Cache") != "MISS" || calls != 4 {
+		t.Error(w.Header(), calls)
+	}
+	//the cached responses of authorized api are not shared by callers
+	AuthScheme("cache", func(ctx *Context) error {
+		ctx.SetPrincipal(&Principal{ID: ctx.In.Header.Get("X-User")})
+		return nil
+	})
+	Get("/cache/me", func(ctx *Context) {
+		ctx.JSON(ctx.Principal().ID)
+	}).Auth("cache").Cache(time.Minute).Router()
+	if w := get("/cache/me", "X-User", "alice"); !strings.Contains(w.Body.String(), "alice") {
+		t.Fatal(w.Body.String())
+	}
+	if w := get("/cache/me", "X-User", "bob"); !strings.Contains(w.Body.String(), "bob") || w.Header().Get("X-Cache") != "MISS" {
+		t.Fatal(w.Header(), w.Body.String())
+	}
+	if w := get("/cache/me", "X-User", "alice"); w.Header().Get("X-Cache") != "HIT" {
+		t.Error(w.Header())
+	}
+	//the request has credentials
+	if w := get("/cache/users?id=2", "Authorization", "Bearer x"); w.Header().Get("X-Cache") != "MISS" {
+		t.Error(w.Header())
+	}
+	//the cookies of public api are ignored
+	if w := get("/cache/users?id=2", "Cookie", "_sid=x"); w.Header().Get("X-Cache") != "HIT" {
+		t.Error(w.Header())
+	}
+}
+
+func TestCORS(t *testing.T) {
+	freshRouter(t)
+	cors := app.cors
+	defer func() { app.cors = cors }()
+	app.cors = newCORS(&conf.CORSConf{AllowOrigin: "https://a.com, https://*.b.com", AllowOriginRegex: []string{`^https://c[0-9]+\.com$`}, ExposeHeaders: "X-Total"})
+	//the regexps match the full origin
+	p := newCORS(&conf.CORSConf{AllowOriginRegex: []string{`https://.*\.example\.com`}})
+	if !p.allowOrigin("https://x.example.com") || p.allowOrigin("https://x.example.com.attacker.net") || p.allowOrigin("http://evil.com/https://x.example.com") {
+		t.Error("the regexp of origin is not anchored")
+	}
+	Get("/cors/default", func(ctx *Context) {
+		ctx.JSON("bast")
+	})
+	Put("/cors/default", func(ctx *Context) {
+		ctx.JSON("bast")
+	})
+	Get("/cors/any", func(ctx *Context) {
+		ctx.JSON("bast")
+	}).CORS(&conf.CORSConf{AllowOrigin: "*", AllowMethods: "GET", AllowHeaders: "*", AllowCredentials: "false"})
+	for _, k := range []string{http.MethodGet + "/cors/default", http.MethodPut + "/cors/default", http.MethodGet + "/cors/any"} {
+		app.pattern[k].Router()
+	}
+	for origin, allowed := range map[string]bool{"https://a.com": true, "https://x.b.com": true, "https://b.com": false,
+		"https://c12.com": true, "https://c.com": false, "https://evil.com": false} {
+		w := request(http.MethodGet, "/cors/default", "Origin", origin)
+		if allowed != (w.Header().Get("Access-Control-Allow-Origin") == origin) {
+			t.Error(origin, w.Header())
+		}
+		if allowed && (w.Header().Get("Access-Control-Expose-Headers") != "X-Total" || w.Header().Get("Access-Control-Allow-Credentials") != "true") {
+			t.Error(origin, w.Header())
+		}
+		if !strings.Contains(strings.Join(w.Header().Values("Vary"), ","), "Origin") {
+			t.Error(origin, w.Header())
+		}
+	}
+	w := request(http.MethodOptions, "/cors/default", "Origin", "https://a.com", "Access-Control-Request-Method", "PUT", "Access-Control-Request-Headers", "content-type")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://a.com" || w.Header().Get("Access-Control-Max-Age") == "" ||
+		!strings.Contains(w.Header().Get("Access-Control-Allow-Methods"), "PUT") {
+		t.Error(w.Code, w.Header())
+	}
+	if w := request(http.MethodOptions, "/cors/default", "Origin", "https://a.com", "Access-Control-Request-Method", "PUT", "Access-Control-Request-Headers", "X-Unknown"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error(w.Header())
+	}
+	if w := request(http.MethodOptions, "/cors/default", "Origin", "https://evil.com", "Access-Control-Request-Method", "GET"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error(w.Header())
+	}
+	if w := request(http.MethodGet, "/cors/any", "Origin", "https://evil.com"); w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error(w.Header())
+	}
+	if w := request(http.MethodOptions, "/cors/any", "Origin", "https://evil.com", "Access-Control-Request-Method", "GET", "Access-Control-Request-Headers", "X-Any"); w.Header().Get("Access-Control-Allow-Headers") != "X-Any" {
+		t.Error(w.Header())
+	}
+	if w := request(http.MethodOptions, "/cors/any", "Origin", "https://evil.com", "Access-Control-Request-Method", "POST"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error(w.Header())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	freshRouter(t)
+	app.metrics = true
+	defer func() { app.metrics = false }()
+	//the counters of previous runs(go test -count=2)
+	metrics.Requests.Reset()
+	metrics.Duration.Reset()
+	metrics.Panics.Reset()
+	metricsRouter(&conf.MetricsConf{Enable: true, Path: "/metrics"})
+	Get("/metrics/users/:id", func(ctx *Context) {
+		if ctx.GetParam("id") == "0" {
+			panic("bast")
+		}
+		ctx.JSON("bast")
+	}).Nickname("metricsUser")
+	for _, k := range []string{"/metrics", "/metrics/users/:id"} {
+		app.pattern[http.MethodGet+k].Router()
+	}
+	get("/metrics/users/1")
+	get("/metrics/users/2")
+	get("/metrics/users/0")
+	w := get("/metrics")
+	body := w.Body.String()
+	for _, v := range []string{
+		`bast_http_requests_total{code="200",method="GET",nickname="metricsUser",pattern="/metrics/users/:id"} 2`,
+		`bast_http_requests_total{code="500",method="GET",nickname="metricsUser",pattern="/metrics/users/:id"} 1`,
+		`bast_http_request_duration_seconds_count{method="GET",nickname="metricsUser",pattern="/metrics/users/:id"} 3`,
+		`bast_http_requests_in_flight{method="GET",nickname="metricsUser",pattern="/metrics/users/:id"} 0`,
+		`bast_http_panics_total{method="GET",nickname="metricsUser",pattern="/metrics/users/:id"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, v) {
+			t.Error(v)
+		}
+	}
+	//the httpc requests without service name are not labelled by host
+	metrics.ClientRequests.Reset()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+	httpc.Get(s.URL).String()
+	httpc.Get(s.URL).Metric("payment").String()
+	httpc.Get(s.URL).HostLabel().String()
+	body = get("/metrics").Body.String()
+	for _, v := range []string{
+		`bast_httpc_requests_total{code="200",method="GET",service="unknown"} 1`,
+		`bast_httpc_requests_total{code="200",method="GET",service="payment"} 1`,
+		`bast_httpc_requests_total{code="200",method="GET",service="` + strings.TrimPrefix(s.URL, "http://") + `"} 1`,
+	} {
+		if !strings.Contains(body, v) {
+			t.Error(v)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	freshRouter(t)
+	//readiness is drained by the shutdown of TestBastApp
+	atomic.StoreInt32(&health.draining, 0)
+	healthRouter(&conf.HealthConf{Enable: true, Liveness: "/healthz", Readiness: "/readyz", Timeout: 100})
+	for _, k := range []string{"/healthz", "/readyz"} {
+		app.pattern[http.MethodGet+k].Router()
+	}
+	do := func(url string) (int, *HealthResult) {
+		w := get(url)
+		r := &HealthResult{}
+		if err := json.Unmarshal(w.Body.Bytes(), r); err != nil {
+			t.Fatal(w.Body.String(), err)
+		}
+		return w.Code, r
+	}
+	Health().Live("ping", func(ctx context.Context) error {
+		return nil
+	})
+	if code, r := do("/readyz"); code != http.StatusOK || r.Status != "ok" || r.Checks["session"] == nil || r.Checks["ping"] == nil {
+		t.Fatal(code, r)
+	}
+	//the registry which has no published routes is ready
+	app.registry = &service.Registry{}
+	if code, r := do("/readyz"); code != http.StatusOK || r.Checks["registry"].Status != "ok" {
+		app.registry = nil
+		t.Fatal(code, r)
+	}
+	app.registry = nil
+	Health().Ready("db", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	defer func() {
+		health.lock.Lock()
+		delete(health.ready, "db")
+		health.lock.Unlock()
+	}()
+	if code, r := do("/healthz"); code != http.StatusOK || r.Status != "ok" || r.Checks["db"] != nil {
+		t.Error(code, r)
+	}
+	code, r := do("/readyz")
+	if code != http.StatusServiceUnavailable || r.Status != "fail" || r.Checks["db"].Status != "fail" || r.Checks["ping"].Status != "ok" {
+		t.Error(code, r)
+	}
+	health.drain()
+	defer atomic.StoreInt32(&health.draining, 0)
+	if code, r := do("/readyz"); code != http.StatusServiceUnavailable || r.Status != "draining" {
+		t.Error(code, r)
+	}
+}
+
+func TestHealthExempt(t *testing.T) {
+	freshRouter(t)
+	atomic.StoreInt32(&health.draining, 0)
+	store, limiters, timeout, middleware, before := app.limitStore, app.limiters, app.timeout, app.middleware, app.Before
+	defer func() {
+		app.limitStore, app.limiters, app.timeout, app.middleware, app.Before = store, limiters, timeout, middleware, before
+	}()
+	app.limitStore = ratelimit.NewMemory()
+	app.limiters = []*limiter{newLimiter("*", ratelimit.Policy{Limit: 1, Window: 60})}
+	app.timeout = time.Nanosecond
+	app.middleware = []Middleware{func(next Handle) Handle {
+		return func(ctx *Context) {
+			ctx.Status(http.StatusUnauthorized)
+		}
+	}}
+	app.Before = func(ctx *Context) error {
+		return errors.New("locked")
+	}
+	healthRouter(&conf.HealthConf{Enable: true, Liveness: "/healthz", Readiness: "/readyz"})
+	Get("/busy", func(ctx *Context) {
+		ctx.Says("ok")
+	}).Router()
+	for _, k := range []string{"/healthz", "/readyz"} {
+		app.pattern[http.MethodGet+k].Router()
+	}
+	if w := get("/busy"); w.Code == http.StatusOK {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	for i := 0; i < 3; i++ {
+		for _, k := range []string{"/healthz", "/readyz"} {
+			if w := get(k); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+				t.Fatal(k, i, w.Code, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestDebugRouter(t *testing.T) {
+	freshRouter(t)
+	authSchemes()
+	debugRouter(&conf.DebugConf{Enable: true, Prefix: "/debug/", Auth: []string{"key"}})
+	for _, k := range []string{"/debug/pprof/*name", "/debug/vars", "/debug/goroutines", "/debug/gc", "/debug/conf"} {
+		app.pattern[http.MethodGet+k].Router()
+	}
+	if w := get("/debug/gc"); w.Code != http.StatusUnauthorized {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	for url, want := range map[string]string{
+		"/debug/pprof/":             "goroutine",
+		"/debug/pprof/heap?debug=1": "heap profile",
+		"/debug/pprof/cmdline":      "bast",
+		"/debug/vars":               "memstats",
+		"/debug/goroutines":         "goroutine",
+		"/debug/gc":                 "numGC",
+	} {
+		if w := get(url, "X-Key", "k"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Error(url, w.Code, w.Body.String())
+		}
+	}
+	c := &conf.AppConf{Key: "app", JWT: &jwt.Conf{Secret: "s3cret"}, Conf: map[string]interface{}{"dbPassword": "p", "host": "h", "db": "u:dsnpass@tcp(h)/db", "url": "redis://u:urlpass@h:6379/0", "pg": "host=h password=pgpass"}}
+	data, _ := json.Marshal(maskConf(c, true))
+	if s := string(data); strings.Contains(s, "s3cret") || strings.Contains(s, `"p"`) || strings.Contains(s, "dsnpass") || strings.Contains(s, "urlpass") || strings.Contains(s, "pgpass") || !strings.Contains(s, `"h"`) || !strings.Contains(s, "redis://******@h:6379/0") {
+		t.Error(s)
+	}
+	//the user config is left out by default
+	data, _ = json.Marshal(maskConf(c, false))
+	if s := string(data); strings.Contains(s, `"host"`) || !strings.Contains(s, `"key":"app"`) {
+		t.Error(s)
+	}
+	//the debug mode don't serve the debug routes on the app address without authorization schemes
+	debug := app.Debug
+	app.Debug = true
+	debugRouter(&conf.DebugConf{Enable: true, Prefix: "/debug2"})
+	app.Debug = debug
+	if _, ok := app.pattern[http.MethodGet+"/debug2/gc"]; ok {
+		t.Error("the debug routes are public")
+	}
+}
+
+func TestHandoff(t *testing.T) {
+	if !handoff() {
+		t.Skip("handoff is not supported")
+	}
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := probe.Addr().String()
+	probe.Close()
+	c := &conf.AppConf{Key: "handoff", Addr: addr}
+	f := listenFile(c)
+	if f == nil || listenFile(c) != f {
+		t.Fatal("master listener is not cached")
+	}
+	defer delete(app.listeners, c.Key)
+	cmd := workCommand(c, 1)
+	if len(cmd.ExtraFiles) != 1 || cmd.Env[len(cmd.Env)-1] != listenerEnv+"=3" || cmd.Env[len(cmd.Env)-2] != workerIndexEnv+"=1" {
+		t.Fatal(cmd.ExtraFiles, cmd.Env)
+	}
+	//the work process inherit the listener of master
+	os.Setenv(listenerEnv, strconv.Itoa(int(f.Fd())))
+	l, err := inheritedListener(addr)
+	if err != nil || l == nil {
+		t.Fatal(l, err)
+	}
+	//the fd is closed by inheritedListener
+	f.Close()
+	if os.Getenv(listenerEnv) != "" {
+		t.Error("listener env is not cleared")
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("handoff"))
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+	rsp, err := http.Get("http://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if string(data) != "handoff" {
+		t.Error(string(data))
+	}
+	if l, err := inheritedListener(addr); l != nil || err != nil {
+		t.Error(l, err)
+	}
+	//the admin listener is passed to the first work process only
+	probe, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	debugAddr := probe.Addr().String()
+	probe.Close()
+	c.DebugRouter = &conf.DebugConf{Enable: true, Addr: debugAddr}
+	defer delete(app.listeners, c.Key+"#debug")
+	if cmd := workCommand(c, 1); len(cmd.ExtraFiles) != 1 {
+		t.Error(cmd.ExtraFiles)
+	}
+	cmd = workCommand(c, 0)
+	if len(cmd.ExtraFiles) != 2 || cmd.Env[len(cmd.Env)-1] != debugListenerEnv+"=4" {
+		t.Fatal(cmd.ExtraFiles, cmd.Env)
+	}
+	df := cmd.ExtraFiles[1]
+	if debugListenFile(c) != df {
+		t.Error("admin listener is not cached")
+	}
+	os.Setenv(debugListenerEnv, strconv.Itoa(int(df.Fd())))
+	dl, err := inheritedListenerOf(debugListenerEnv, debugAddr)
+	if err != nil || dl == nil {
+		t.Fatal(dl, err)
+	}
+	dl.Close()
+	df.Close()
+}
+
+func TestWorkers(t *testing.T) {
+	c := &conf.AppConf{Key: "workers", Workers: 4}
+	if n := workers(c); handoff() && n != 4 || !handoff() && n != 1 {
+		t.Fatal(n)
+	}
+	c.IDNode = 254
+	if n := workers(c); handoff() && n != 2 {
+		t.Fatal(n)
+	}
+	c.Workers = 0
+	c.IDNode = 0
+	if n := workers(c); n != 1 {
+		t.Fatal(n)
+	}
+	//the id nodes of app confs are not overlapped
+	if err := checkIDNodes([]conf.AppConf{{Key: "a", Workers: 2}, {Key: "b", IDNode: 2, Workers: 2}}); err != nil {
+		t.Error(err)
+	}
+	if err := checkIDNodes([]conf.AppConf{{Key: "a", Workers: 2}, {Key: "b", IDNode: 1, Workers: 2}}); handoff() && err == nil {
+		t.Error("the id nodes are overlapped")
+	}
+	if err := checkIDNodes([]conf.AppConf{{Key: "a", Workers: 2}, {Key: "b", IDNode: 1}}); handoff() && err == nil {
+		t.Error("the id nodes are overlapped")
+	}
+	//the app confs which have 1 worker share the default id node as before
+	if err := checkIDNodes([]conf.AppConf{{Key: "a"}, {Key: "b"}}); err != nil {
+		t.Error(err)
+	}
+	//the id node of work process is idNode + worker index
+	defer ids.SetIDNode(0)
+	os.Setenv(workerIndexEnv, "3")
+	defer os.Unsetenv(workerIndexEnv)
+	workerIDNode(&conf.AppConf{IDNode: 2})
+	if n := ids.New().Generate().Node(); n != 5 {
+		t.Fatal(n)
+	}
+	for addr, want := range map[string]bool{":8080": true, "0.0.0.0:8080": true, "127.0.0.1:8080": false, ":8081": false} {
+		if sameAddr(&net.TCPAddr{IP: net.IPv6unspecified, Port: 8080}, addr) != want {
+			t.Error(addr, !want)
+		}
+	}
+	if !sameAddr(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}, "127.0.0.1:8080") {
+		t.Error("127.0.0.1:8080")
+	}
+	if !reusePort() {
+		return
+	}
+	l1, err := listenReusePort("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.Close()
+	l2, err := listenReusePort(l1.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2.Close()
+}
+
+func TestControl(t *testing.T) {
+	oldName, oldCmd := app.pipeName, app.cmd
+	defer func() {
+		app.pipeName, app.cmd = oldName, oldCmd
+	}()
+	app.pipeName = "bast-control-test-" + strconv.Itoa(os.Getpid())
+	//the work process
+	l, err := pipe.Listen(workPipe(app.pipeName, os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go pipe.Serve(l, workControl)
+	name := workPipe(app.pipeName, os.Getpid())
+	ws := &WorkStatus{}
+	if err := pipe.Call(name, cmdStatus, nil, ws, time.Second); err != nil || ws.Pid != os.Getpid() {
+		t.Fatal(ws, err)
+	}
+	defer logs.SetLevel(logs.Level())
+	var level string
+	if err := pipe.Call(name, cmdLog, "warn", &level, time.Second); err != nil || level != "warn" {
+		t.Fatal(level, err)
+	}
+	if err := pipe.Call(name, cmdLog, "verbose", nil, time.Second); err == nil {
+		t.Error("invalid level is set")
+	}
+	stats := map[string]interface{}{}
+	if err := pipe.Call(name, cmdStats, nil, &stats, time.Second); err != nil || stats["goroutines"] == nil {
+		t.Fatal(stats, err)
+	}
+	//the master
+	m := newMaster()
+	if err := m.serve(); err != nil {
+		t.Fatal(err)
+	}
+	defer app.pipe.Close()
+	go func() {
+		for f := range m.calls {
+			f()
+		}
+	}()
+	app.cmd = []work{{key: "app", cmd: &exec.Cmd{Process: &os.Process{Pid: 7}}, runing: true, exitCount: 2}}
+	s := &MasterStatus{}
+	if err := pipe.Call(app.pipeName, cmdStatus, nil, s, time.Second); err != nil || s.Pid != os.Getpid() || len(s.Works) != 1 || s.Works[0].Pid != 7 || s.Works[0].Restarts != 2 {
+		t.Fatal(s, err)
+	}
+	//the ready of unknown pid is ignored
+	if err := pipe.Call(app.pipeName, cmdReady, 8, nil, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := pipe.Call(app.pipeName, "restart", nil, nil, time.Second); err == nil {
+		t.Error("unknown command is handled")
+	}
+	//the master fan out the commands to the work processes(the pid 7 is not listening)
+	app.cmd = append(app.cmd, work{key: "app", index: 1, cmd: &exec.Cmd{Process: &os.Process{Pid: os.Getpid()}}, runing: true})
+	rs := []WorkResult{}
+	if err := pipe.Call(app.pipeName, cmdLog, "error", &rs, 2*controlTimeout); err != nil || len(rs) != 2 {
+		t.Fatal(rs, err)
+	}
+	if rs[0].Pid != 7 || rs[0].Error == "" || rs[1].Worker != 1 || rs[1].Error != "" || string(rs[1].Data) != `"error"` || logs.Level() != "error" {
+		t.Fatal(rs, logs.Level())
+	}
+	app.cmd = app.cmd[1:]
+	rs = []WorkResult{}
+	if err := pipe.Call(app.pipeName, cmdStats, nil, &rs, time.Second); err != nil || len(rs) != 1 || rs[0].Error != "" || len(rs[0].Data) == 0 {
+		t.Fatal(rs, err)
+	}
+	//the call is failed when the check loop is blocked
+	blocked := newMaster()
+	go func() {
+		<-blocked.calls
+	}()
+	if _, err := blocked.call(func() (interface{}, error) { return nil, nil }); err == nil {
+		t.Error("the blocked call is finished")
+	}
+}
+
+func TestListen(t *testing.T) {
+	if n, a := splitAddr("unix:/run/app.sock"); n != "unix" || a != "/run/app.sock" || !isUnix("unix:/run/app.sock") {
+		t.Fatal(n, a)
+	}
+	if n, a := splitAddr(":8080"); n != "tcp" || a != ":8080" || isUnix(":8080") {
+		t.Fatal(n, a)
+	}
+	if m := socketMode(&conf.AppConf{SocketMode: "0660"}); m != 0660 {
+		t.Fatal(m)
+	}
+	if m := socketMode(&conf.AppConf{SocketMode: "rw"}); m != 0 {
+		t.Fatal(m)
+	}
+	if useReusePort(&conf.AppConf{Addr: "unix:/run/app.sock", ReusePort: true}) {
+		t.Error("unix socket listen with SO_REUSEPORT")
+	}
+	dir, err := ioutil.TempDir("", "bast-listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := unixPrefix + filepath.Join(dir, "app.sock")
+	l, err := listen(addr, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "app.sock")); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatal(fi, err)
+	}
+	if !sameAddr(l.Addr(), addr) || sameAddr(l.Addr(), ":8080") {
+		t.Fatal(l.Addr())
+	}
+	//the listening socket is not removed
+	if _, err := listen(addr, 0); err == nil {
+		t.Fatal("listen the socket which is listening")
+	}
+	//the stale socket is removed
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if l, err = listen(addr, 0); err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("unix"))
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+	client := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, network, a string) (net.Conn, error) {
+		network, path := splitAddr(addr)
+		return net.Dial(network, path)
+	}}}
+	rsp, err := client.Get("http://unix/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if string(data) != "unix" {
+		t.Fatal(string(data))
+	}
+	if !handoff() {
+		return
+	}
+	//systemd socket activation
+	tl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := tl.(*net.TCPListener).File()
+	tl.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(listenPidEnv, "1")
+	os.Setenv(listenFdsEnv, "1")
+	if ls := activationListeners(int(f.Fd())); ls != nil || os.Getenv(listenFdsEnv) != "" {
+		t.Fatal("the listeners of other process are used")
+	}
+	os.Setenv(listenPidEnv, strconv.Itoa(os.Getpid()))
+	os.Setenv(listenFdsEnv, "1")
+	os.Setenv(listenNamesEnv, "http")
+	ls := activationListeners(int(f.Fd()))
+	//the fd is closed by activationListeners
+	f.Close()
+	if len(ls) != 1 || !sameAddr(ls[0].Addr(), tl.Addr().String()) || os.Getenv(listenPidEnv) != "" {
+		t.Fatal(ls)
+	}
+	ls[0].Close()
+}
+
+func TestNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bast-notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	recv := func() string {
+		buf := make([]byte, 256)
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return ""
+		}
+		return string(buf[:n])
+	}
+	os.Setenv(notifySocketEnv, path)
+	os.Setenv(watchdogUsecEnv, "2000000")
+	os.Setenv(watchdogPidEnv, strconv.Itoa(os.Getpid()))
+	n := newNotifier()
+	if n.addr != path || n.watchdog != time.Second || os.Getenv(notifySocketEnv) != "" || os.Getenv(watchdogUsecEnv) != "" {
+		t.Fatal(n)
+	}
+	if err := n.notify("READY=1"); err != nil || recv() != "READY=1" {
+		t.Fatal(err)
+	}
+	if err := n.reloading(); err != nil {
+		t.Fatal(err)
+	}
+	if state := recv(); !strings.HasPrefix(state, "RELOADING=1") {
+		t.Fatal(state)
+	}
+	//the watchdog of other process is not pinged
+	os.Setenv(watchdogUsecEnv, "2000000")
+	os.Setenv(watchdogPidEnv, "1")
+	if w := newNotifier().watchdog; w != 0 {
+		t.Fatal(w)
+	}
+	//the disabled notifier
+	if err := newNotifier().notify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	//the master is ready when all work processes are ready
+	oldCmd, oldSystemd := app.cmd, systemd
+	defer func() {
+		app.cmd, systemd = oldCmd, oldSystemd
+	}()
+	systemd = n
+	m := newMaster()
+	app.cmd = []work{
+		{key: "app", cmd: &exec.Cmd{Process: &os.Process{Pid: 7}}, runing: true},
+		{key: "app", index: 1, cmd: &exec.Cmd{Process: &os.Process{Pid: 8}}, runing: true},
+	}
+	m.ready(7)
+	m.notifyReady()
+	if state := recv(); state != "" {
+		t.Fatal(state)
+	}
+	m.ready(8)
+	m.notifyReady()
+	if state := recv(); state != "READY=1" {
+		t.Fatal(state)
+	}
+	m.notifyReady()
+	if state := recv(); state != "" {
+		t.Fatal("READY=1 is sent again")
+	}
+	m.watchdog()
+	if state := recv(); state != "WATCHDOG=1" {
+		t.Fatal(state)
+	}
+	//the watchdog pings stop when a work process is crash looping
+	app.cmd[1].failed = true
+	m.watchdog()
+	if state := recv(); state != "" {
+		t.Fatal(state)
+	}
+	//the fake work processes are not stopped
+	app.cmd = nil
+	m.stop()
+	if state := recv(); state != "STOPPING=1" {
+		t.Fatal(state)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	oldName, oldCmd, oldRuning := app.pipeName, app.cmd, app.runing
+	defer func() {
+		app.pipeName, app.cmd, app.runing = oldName, oldCmd, oldRuning
+	}()
+	app.pipeName = "bast-status-test-" + strconv.Itoa(os.Getpid())
+	app.runing = true
+	Version("1.2.3")
+	defer Version("")
+	l, err := pipe.Listen(workPipe(app.pipeName, os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go pipe.Serve(l, workControl)
+	m := newMaster()
+	if err := m.serve(); err != nil {
+		t.Fatal(err)
+	}
+	defer app.pipe.Close()
+	go func() {
+		for f := range m.calls {
+			f()
+		}
+	}()
+	app.cmd = []work{{key: "app", cmd: &exec.Cmd{Process: &os.Process{Pid: os.Getpid()}}, runing: true, exitCount: 1}}
+	s := collectStatus(os.Getpid(), app.pipeName)
+	if !s.OK || len(s.Works) != 1 || s.Works[0].Version != "1.2.3" || s.Works[0].Uptime == "" || s.Works[0].Restarts != 1 || s.Works[0].Error != "" {
+		t.Fatal(s)
+	}
+	var buf bytes.Buffer
+	if err := printStatus(&buf, s, false); err != nil || !strings.Contains(buf.String(), "IN-FLIGHT") || !strings.Contains(buf.String(), "1.2.3") {
+		t.Fatal(buf.String(), err)
+	}
+	buf.Reset()
+	v := &Status{}
+	if err := printStatus(&buf, s, true); err != nil || json.Unmarshal(buf.Bytes(), v) != nil || !v.OK {
+		t.Fatal(buf.String(), err)
+	}
+	//the work process which is exited
+	app.cmd = append(app.cmd, work{key: "app", index: 1})
+	if s := collectStatus(os.Getpid(), app.pipeName); s.OK || len(s.Works) != 2 || s.Works[1].Error == "" {
+		t.Fatal(s)
+	}
+	//the master is not running
+	if s := collectStatus(0, ""); s.OK || s.Alive {
+		t.Fatal(s)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	rc := conf.RestartOf(nil)
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second} {
+		if d := backoff(rc, i+1); d != want {
+			t.Error(i+1, d)
+		}
+	}
+	now := time.Now()
+	w := &work{}
+	rc.MaxCrashes = 2
+	if !w.crash(rc, now) || !w.crash(rc, now.Add(time.Second)) || w.crash(rc, now.Add(2*time.Second)) {
+		t.Fatal(w.crashes)
+	}
+	//the crashes out of window are dropped
+	if !w.crash(rc, now.Add(2*time.Minute)) || len(w.crashes) != 1 {
+		t.Fatal(w.crashes)
+	}
+	oldCmd := app.cmd
+	defer func() {
+		app.cmd = oldCmd
+	}()
+	m := newMaster()
+	app.cmd = []work{{key: "restart"}, {key: "loop", crashes: []time.Time{now, now, now, now, now}}}
+	m.restart(0, true)
+	m.restart(1, true)
+	if s := app.cmd[0].state(); s != "restarting" || restartings() != 1 {
+		t.Fatal(s)
+	}
+	if s := app.cmd[1].state(); s != "failed" {
+		t.Fatal(s)
+	}
+	select {
+	case i := <-m.restarts:
+		if i != 0 {
+			t.Fatal(i)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("not restarted")
+	}
+	m.stopping = true
+	m.started(0)
+	if s := app.cmd[0].state(); s != "stopped" {
+		t.Fatal(s)
+	}
+	//the clean exits are not counted as crashes, the restarts are dropped when the check loop is exited
+	m = newMaster()
+	app.cmd = []work{{key: "clean"}}
+	for i := 0; i < 10; i++ {
+		m.restart(0, false)
+	}
+	if w := app.cmd[0]; w.state() != "restarting" || len(w.crashes) != 0 {
+		t.Fatal(w.state(), w.crashes)
+	}
+	close(m.quit)
+}
+
+func TestStopWorks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sleep is not found")
+	}
+	oldCmd := app.cmd
+	defer func() {
+		app.cmd = oldCmd
+	}()
+	app.cmd = nil
+	//the master and work process which are not listening the control pipes
+	exited := make(chan string, 2)
+	start := func(name string) *exec.Cmd {
+		cmd := exec.Command("sleep", "30")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			cmd.Wait()
+			exited <- name
+		}()
+		return cmd
+	}
+	mcmd, wcmd := start("master"), start("work")
+	defer mcmd.Process.Kill()
+	defer wcmd.Process.Kill()
+	pidPath := os.Args[0] + ".pid"
+	pids := strconv.Itoa(mcmd.Process.Pid) + "|bast-stop-test-" + strconv.Itoa(os.Getpid()) + ":" + strconv.Itoa(wcmd.Process.Pid)
+	if err := ioutil.WriteFile(pidPath, []byte(pids), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(pidPath)
+	stopWorks()
+	//the master is exited before the work process is signalled, so it doesn't restart it
+	for _, want := range []string{"master", "work"} {
+		select {
+		case name := <-exited:
+			if name != want {
+				t.Fatal(name, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal(want + " is not exited")
+		}
+	}
+}
+
 func startApp() {
 	appStarted = true
 	go Run(":9999")
@@ -76,4 +1571,6 @@ func init() {
 func exitApp() {
 	appStarted = false
 	Shutdown(nil)
+	//the closed server can't serve again(go test -count=2)
+	app.Server = &http.Server{}
 }
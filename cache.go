@@ -0,0 +1,282 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axfor/bast/cache"
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/httpc"
+	"github.com/axfor/bast/logs"
+)
+
+//CacheKey return the cache key of request(default is path and sorted query)
+type CacheKey func(ctx *Context) string
+
+//responseCache is the response cache of route
+type responseCache struct {
+	ttl  time.Duration
+	key  CacheKey
+	tags []string
+}
+
+//flight is a request which is rendering the response of key(stampede protection)
+type flight struct {
+	done  chan struct{}
+	entry *cache.Entry
+}
+
+var (
+	flightLock sync.Mutex
+	flights    = map[string]*flight{}
+)
+
+//uncachedHeaders are the headers of each request, they are not cached
+var uncachedHeaders = []string{"Set-Cookie", "Vary", "Date", "Content-Length", "Content-Encoding", "X-Cache", "Age", "Retry-After",
+	"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", httpc.RequestIDHeader,
+	"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Access-Control-Expose-Headers"}
+
+//Cache cache the full response(status, headers and body) of GET/HEAD api with ttl
+//the cache varies on key(default is path and sorted query), Accept(KindAccept) and Accept-Language.
+//the cache varies on the caller(principal, Authorization and Cookie) too when the api needs authorization or the request has credentials,
+//the custom key must include the identity of caller when the api is authorized by other ways(such as: token of query).
+//only the 200 responses without 'Cache-Control: no-store|private' are cached,
+//concurrent requests of same key wait for the first one instead of calling the handle
+func (c *Pattern) Cache(ttl time.Duration, key ...CacheKey) *Pattern {
+	rc := &responseCache{ttl: ttl, key: cacheByQuery}
+	if len(key) > 0 && key[0] != nil {
+		rc.key = key[0]
+	}
+	if c.cache != nil {
+		rc.tags = c.cache.tags
+	}
+	c.cache = rc
+	return c
+}
+
+//CacheTags set the tags of the cached response of api(see InvalidateCache)
+func (c *Pattern) CacheTags(tags ...string) *Pattern {
+	if c.cache == nil {
+		c.cache = &responseCache{key: cacheByQuery}
+	}
+	c.cache.tags = append(c.cache.tags, tags...)
+	return c
+}
+
+//CacheTags add the tags of the cached response of current request(such as: user:1)
+func (c *Context) CacheTags(tags ...string) {
+	c.cacheTags = append(c.cacheTags, tags...)
+}
+
+//InvalidateCache delete the cached responses of tags
+//the memory store is per process, the redis store is needed to invalidate the cache of all work processes
+func InvalidateCache(tags ...string) error {
+	return cacheStore().Invalidate(tags...)
+}
+
+//CacheStore set the store of response cache(default is the engine of 'cache' app config)
+func CacheStore(s cache.Store) {
+	app.cacheStore = s
+}
+
+//initCache init the store of response cache from the 'cache' app config
+//redis engine use the redis of session config when it's not configured
+func initCache(c *cache.Conf) {
+	if c.Engine == "redis" && c.Redis == nil {
+		if s := conf.Session(); s != nil {
+			c.Redis = s.Redis
+		}
+	}
+	s, err := cache.New(c)
+	if err != nil {
+		logs.Errors("cache init failed, use memory store", err)
+		s = cache.NewMemory(c.Size)
+	}
+	app.cacheStore = s
+}
+
+//cacheStore return the store of response cache
+func cacheStore() cache.Store {
+	if app.cacheStore == nil {
+		app.cacheStore = cache.NewMemory(0)
+	}
+	return app.cacheStore
+}
+
+//cacheByQuery return the path and sorted query of request
+func cacheByQuery(ctx *Context) string {
+	return ctx.In.URL.Path + "?" + ctx.In.URL.Query().Encode()
+}
+
+//cacheIdentity return the identity of caller so the cached response of a caller is not served to others, empty is shared.
+//it's the principal(or session) of the api which needs authorization, or the Authorization header of public api,
+//the cookies of public api are ignored(such as: the cookie of session)
+func cacheIdentity(ctx *Context) string {
+	id := ""
+	if ctx.Router.authorization {
+		if p := ctx.Principal(); p != nil && p.ID != "" {
+			id = "principal:" + p.ID
+		} else if sid := ctx.SessionID(); sid != "" {
+			id = "session:" + sid
+		}
+	}
+	if id == "" {
+		if auth := ctx.In.Header.Get("Authorization"); auth != "" {
+			id = "authorization:" + auth
+		} else if !ctx.Router.authorization {
+			return ""
+		}
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+//serveCache output the cached response of request, otherwise call fn and cache its response
+func serveCache(ctx *Context, fn func(ctx *Context)) {
+	r := ctx.In
+	rc := ctx.Router.cache
+	if rc.ttl <= 0 || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		fn(ctx)
+		return
+	}
+	key := http.MethodGet + " " + ctx.Router.Pattern + "|" + rc.key(ctx) + "|" + strconv.Itoa(ctx.KindAccept) + "|" + r.Header.Get("Accept-Language") + "|" + cacheIdentity(ctx)
+	store := cacheStore()
+	e, err := store.Get(key)
+	if err != nil {
+		ctx.Log().Errors("cache get error", err)
+	}
+	if e != nil {
+		writeCache(ctx, e)
+		return
+	}
+	if r.Method == http.MethodHead {
+		fn(ctx)
+		return
+	}
+	flightLock.Lock()
+	if f, ok := flights[key]; ok {
+		flightLock.Unlock()
+		select {
+		case <-f.done:
+		case <-ctx.Context().Done():
+			return
+		}
+		if f.entry != nil {
+			writeCache(ctx, f.entry)
+		} else {
+			fn(ctx)
+		}
+		return
+	}
+	f := &flight{done: make(chan struct{})}
+	flights[key] = f
+	flightLock.Unlock()
+	defer func() {
+		flightLock.Lock()
+		delete(flights, key)
+		flightLock.Unlock()
+		close(f.done)
+	}()
+	cw := &cacheWriter{ResponseWriter: ctx.Out}
+	ctx.Out = cw
+	cw.Header().Set("X-Cache", "MISS")
+	fn(ctx)
+	ctx.Out = cw.ResponseWriter
+	if e = cw.entry(); e == nil {
+		return
+	}
+	e.Tags = append(append(e.Tags, rc.tags...), ctx.cacheTags...)
+	if err := store.Set(key, e, rc.ttl); err != nil {
+		ctx.Log().Errors("cache set error", err)
+		return
+	}
+	f.entry = e
+}
+
+//writeCache output the cached response, 304 is output when the If-None-Match is matched
+func writeCache(ctx *Context, e *cache.Entry) {
+	h := ctx.Out.Header()
+	for k, v := range e.Header {
+		h[k] = v
+	}
+	h.Set("X-Cache", "HIT")
+	h.Set("Age", strconv.FormatInt(int64(time.Since(e.Created)/time.Second), 10))
+	if etag := h.Get("ETag"); etag != "" {
+		if inm := ctx.In.Header.Get("If-None-Match"); inm != "" && matchETag(inm, etag, true) {
+			h.Del("Content-Type")
+			ctx.Out.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	ctx.Out.WriteHeader(e.Status)
+	if ctx.In.Method != http.MethodHead {
+		ctx.Out.Write(e.Body)
+	}
+}
+
+//cacheWriter record the response of handle
+type cacheWriter struct {
+	http.ResponseWriter
+	header   http.Header
+	code     int
+	body     []byte
+	hijacked bool
+}
+
+func (cw *cacheWriter) WriteHeader(code int) {
+	if cw.code == 0 {
+		cw.code = code
+		cw.header = cw.Header().Clone()
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cacheWriter) Write(p []byte) (int, error) {
+	if cw.code == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	cw.body = append(cw.body, p...)
+	return cw.ResponseWriter.Write(p)
+}
+
+//entry return the cache entry of response, nil is not cacheable
+func (cw *cacheWriter) entry() *cache.Entry {
+	if cw.code != http.StatusOK || cw.hijacked {
+		return nil
+	}
+	cc := strings.ToLower(cw.header.Get("Cache-Control"))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") {
+		return nil
+	}
+	for _, k := range uncachedHeaders {
+		cw.header.Del(k)
+	}
+	return &cache.Entry{Status: cw.code, Header: cw.header, Body: cw.body, Created: time.Now()}
+}
+
+//Flush sends any buffered data to the client
+func (cw *cacheWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Hijack implements the http.Hijacker interface, the response is not cached
+func (cw *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("not support http hijacker")
+	}
+	cw.hijacked = true
+	return h.Hijack()
+}
@@ -0,0 +1,55 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// Package cache provides the http response cache stores(in-memory LRU and redis)
+//with tag-based invalidation.
+package cache
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	sessionConf "github.com/axfor/bast/session/conf"
+)
+
+//ErrorNotFondRedisConf not fond redis conf
+var ErrorNotFondRedisConf = errors.New("not fond redis conf of cache")
+
+//Conf is response cache config
+type Conf struct {
+	Engine string                 `json:"engine"` //memory|redis(default is memory)
+	Size   int                    `json:"size"`   //max entries of memory store(default is 10000)
+	Prefix string                 `json:"prefix"` //key prefix of redis(default is cache:)
+	Redis  *sessionConf.RedisConf `json:"redis"`  //default is redis of session config
+}
+
+//Entry is a cached response
+type Entry struct {
+	Status  int         `json:"status"`
+	Header  http.Header `json:"header"`
+	Body    []byte      `json:"body"`
+	Tags    []string    `json:"tags"`
+	Created time.Time   `json:"created"`
+}
+
+//Store is response cache store
+type Store interface {
+	//Get return the entry of key, nil is not exist or expired
+	Get(key string) (*Entry, error)
+	//Set store the entry of key with ttl
+	Set(key string, e *Entry, ttl time.Duration) error
+	//Invalidate delete the entries of tags
+	Invalidate(tags ...string) error
+}
+
+//New create a store by engine of config(memory or redis)
+func New(c *Conf) (Store, error) {
+	if c != nil && c.Engine == "redis" {
+		return NewRedis(c.Redis, c.Prefix)
+	}
+	size := 0
+	if c != nil {
+		size = c.Size
+	}
+	return NewMemory(size), nil
+}
@@ -0,0 +1,45 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_MemoryLRU(t *testing.T) {
+	now := time.Unix(1000, 0)
+	m := NewMemory(2)
+	m.now = func() time.Time { return now }
+	m.Set("a", &Entry{Body: []byte("a")}, time.Second)
+	m.Set("b", &Entry{Body: []byte("b")}, time.Second)
+	if e, _ := m.Get("a"); e == nil || string(e.Body) != "a" {
+		t.Fatal(e)
+	}
+	m.Set("c", &Entry{Body: []byte("c")}, time.Second)
+	if e, _ := m.Get("b"); e != nil || m.Len() != 2 {
+		t.Fatal("b is not evicted")
+	}
+	now = now.Add(time.Second)
+	if e, _ := m.Get("a"); e != nil || m.Len() != 1 {
+		t.Fatal("a is not expired")
+	}
+}
+
+func Test_MemoryInvalidate(t *testing.T) {
+	m := NewMemory(0)
+	m.Set("a", &Entry{Tags: []string{"users", "user:1"}}, time.Minute)
+	m.Set("b", &Entry{Tags: []string{"users"}}, time.Minute)
+	m.Set("c", &Entry{Tags: []string{"orders"}}, time.Minute)
+	m.Invalidate("user:1")
+	if e, _ := m.Get("a"); e != nil {
+		t.Fatal("a is not invalidated")
+	}
+	if e, _ := m.Get("b"); e == nil {
+		t.Fatal("b is invalidated")
+	}
+	m.Invalidate("users")
+	if e, _ := m.Get("b"); e != nil || m.Len() != 1 || len(m.tags) != 1 {
+		t.Fatal(m.Len(), m.tags)
+	}
+}
@@ -0,0 +1,119 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+//defaultSize is the default max entries of memory store
+const defaultSize = 10000
+
+//Memory is in-process LRU store
+type Memory struct {
+	lock    sync.Mutex
+	size    int
+	lru     *list.List //front is the most recently used
+	entries map[string]*list.Element
+	tags    map[string]map[string]struct{} //tag -> keys
+	now     func() time.Time
+}
+
+//item is the element of lru
+type item struct {
+	key    string
+	entry  *Entry
+	expire time.Time
+}
+
+//NewMemory create in-process LRU store, size is the max entries(default is 10000)
+func NewMemory(size int) *Memory {
+	if size <= 0 {
+		size = defaultSize
+	}
+	return &Memory{
+		size:    size,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+		tags:    map[string]map[string]struct{}{},
+		now:     time.Now,
+	}
+}
+
+//Get return the entry of key, nil is not exist or expired
+func (m *Memory) Get(key string) (*Entry, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	it := el.Value.(*item)
+	if !m.now().Before(it.expire) {
+		m.remove(el)
+		return nil, nil
+	}
+	m.lru.MoveToFront(el)
+	return it.entry, nil
+}
+
+//Set store the entry of key with ttl, the least recently used entry is evicted when it's full
+func (m *Memory) Set(key string, e *Entry, ttl time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.remove(el)
+	}
+	el := m.lru.PushFront(&item{key: key, entry: e, expire: m.now().Add(ttl)})
+	m.entries[key] = el
+	for _, t := range e.Tags {
+		keys, ok := m.tags[t]
+		if !ok {
+			keys = map[string]struct{}{}
+			m.tags[t] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	for m.lru.Len() > m.size {
+		m.remove(m.lru.Back())
+	}
+	return nil
+}
+
+//Invalidate delete the entries of tags
+func (m *Memory) Invalidate(tags ...string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, t := range tags {
+		for k := range m.tags[t] {
+			if el, ok := m.entries[k]; ok {
+				m.remove(el)
+			}
+		}
+		delete(m.tags, t)
+	}
+	return nil
+}
+
+//Len return the count of entries
+func (m *Memory) Len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.lru.Len()
+}
+
+//remove delete the element from lru and tags
+func (m *Memory) remove(el *list.Element) {
+	it := m.lru.Remove(el).(*item)
+	delete(m.entries, it.key)
+	for _, t := range it.entry.Tags {
+		if keys, ok := m.tags[t]; ok {
+			delete(keys, it.key)
+			if len(keys) == 0 {
+				delete(m.tags, t)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package cache
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	sessionConf "github.com/axfor/bast/session/conf"
+	"github.com/go-redis/redis"
+)
+
+//tagScript add the key to the set of tag, and extend the expiration of set to ttl
+//KEYS[1] is tag, ARGV is key,ttl(millisecond)
+var tagScript = redis.NewScript(`
+redis.call('SADD', KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if redis.call('PTTL', KEYS[1]) < ttl then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+//Redis is redis store, entries are shared by all processes and nodes
+type Redis struct {
+	c      redis.UniversalClient
+	prefix string
+}
+
+//NewRedis create redis store
+//addrs of conf is a list split by ',', more than one is redis cluster
+func NewRedis(c *sessionConf.RedisConf, prefix string) (*Redis, error) {
+	if c == nil || c.Addrs == "" {
+		return nil, ErrorNotFondRedisConf
+	}
+	if prefix == "" {
+		prefix = "cache:"
+	}
+	r := &Redis{
+		prefix: prefix,
+		c: redis.NewUniversalClient(&redis.UniversalOptions{
+			Addrs:    strings.Split(c.Addrs, ","),
+			Password: c.Password,
+			PoolSize: c.PoolSize,
+		}),
+	}
+	return r, r.c.Ping().Err()
+}
+
+//Get return the entry of key, nil is not exist or expired
+func (r *Redis) Get(key string) (*Entry, error) {
+	data, err := r.c.Get(r.prefix + "e:" + key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+//Set store the entry of key with ttl, the key is added to the set of each tag
+func (r *Redis) Set(key string, e *Entry, ttl time.Duration) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := r.c.Set(r.prefix+"e:"+key, data, ttl).Err(); err != nil {
+		return err
+	}
+	ms := int64(ttl / time.Millisecond)
+	for _, t := range e.Tags {
+		if err := tagScript.Run(r.c, []string{r.prefix + "t:" + t}, key, ms).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Invalidate delete the entries of tags
+func (r *Redis) Invalidate(tags ...string) error {
+	for _, t := range tags {
+		tk := r.prefix + "t:" + t
+		keys, err := r.c.SMembers(tk).Result()
+		if err != nil {
+			return err
+		}
+		p := r.c.Pipeline()
+		for _, k := range keys {
+			p.Del(r.prefix + "e:" + k)
+		}
+		p.Del(tk)
+		if _, err := p.Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Close close the redis connection
+func (r *Redis) Close() error {
+	return r.c.Close()
+}
@@ -0,0 +1,291 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/axfor/bast/conf"
+)
+
+var (
+	gzipPools  sync.Map //level -> *sync.Pool of *gzip.Writer
+	flatePools sync.Map //level -> *sync.Pool of *flate.Writer
+)
+
+//Compress enable the response compression(gzip or deflate) of api
+//cc is the compression config(default is 'compress' of app config)
+func (c *Pattern) Compress(cc ...*conf.CompressConf) *Pattern {
+	if len(cc) > 0 && cc[0] != nil {
+		v := *cc[0]
+		v.Enable = true
+		c.compress = conf.CompressDefault(&v)
+	} else {
+		v := *app.compress
+		v.Enable = true
+		c.compress = &v
+	}
+	return c
+}
+
+//Uncompress disable the response compression of api
+func (c *Pattern) Uncompress() *Pattern {
+	c.compress = &conf.CompressConf{}
+	return c
+}
+
+//compression return the compression config of pattern
+func (c *Pattern) compression() *conf.CompressConf {
+	if c.compress != nil {
+		return c.compress
+	}
+	return app.compress
+}
+
+//compressWriter compress response by the Accept-Encoding of request
+//the compression is decided when the body reaches MinSize, or it's flushed or closed
+type compressWriter struct {
+	http.ResponseWriter
+	c          *conf.CompressConf
+	encoding   string
+	w          io.WriteCloser
+	buf        []byte
+	code       int
+	decided    bool
+	compressed bool
+	hijacked   bool
+}
+
+//newCompressWriter return a compressWriter if the request accept gzip or deflate
+func newCompressWriter(w http.ResponseWriter, r *http.Request, c *conf.CompressConf) *compressWriter {
+	w.Header().Add("Vary", "Accept-Encoding")
+	encoding := acceptEncoding(r.Header.Get("Accept-Encoding"))
+	if encoding == "" || r.Method == http.MethodHead {
+		return nil
+	}
+	return &compressWriter{ResponseWriter: w, c: c, encoding: encoding}
+}
+
+//acceptEncoding return the preferred encoding of Accept-Encoding(gzip or deflate)
+func acceptEncoding(accept string) string {
+	encoding, q := "", 0.0
+	for _, v := range strings.Split(accept, ",") {
+		name, params := v, ""
+		if pos := strings.Index(v, ";"); pos != -1 {
+			name, params = v[0:pos], v[pos+1:]
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "*" {
+			name = "gzip"
+		}
+		if name != "gzip" && name != "deflate" {
+			continue
+		}
+		weight := 1.0
+		if pos := strings.Index(params, "q="); pos != -1 {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(params[pos+2:]), 64); err == nil {
+				weight = f
+			}
+		}
+		if weight > q || (weight == q && name == "gzip") {
+			encoding, q = name, weight
+		}
+	}
+	if q <= 0 {
+		return ""
+	}
+	return encoding
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || cw.code != 0 {
+		return
+	}
+	cw.code = code
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) >= cw.c.MinSize {
+			if err := cw.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if cw.compressed {
+		return cw.w.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+//decide write the header and buffered body, and compress the response
+//when it's enough size(or flushed), allowed type and not encoded
+func (cw *compressWriter) decide(enough bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if enough && len(cw.buf) > 0 && cw.compressible() {
+		cw.compressed = true
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Set("Content-Encoding", cw.encoding)
+		cw.w = compressor(cw.encoding, cw.c.Level, cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.code)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.compressed {
+		_, err = cw.w.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+//compressible return the response is allowed to compress
+func (cw *compressWriter) compressible() bool {
+	if cw.code < http.StatusOK || cw.code == http.StatusNoContent || cw.code == http.StatusNotModified ||
+		cw.code == http.StatusPartialContent {
+		return false
+	}
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	t, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, v := range cw.c.Types {
+		if v == t || (strings.HasSuffix(v, "/*") && strings.HasPrefix(t, v[0:len(v)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+//Close write the buffered body and finish the compression
+func (cw *compressWriter) Close() error {
+	if cw.hijacked {
+		return nil
+	}
+	if !cw.decided {
+		if err := cw.decide(len(cw.buf) >= cw.c.MinSize); err != nil {
+			return err
+		}
+	}
+	if cw.compressed {
+		err := cw.w.Close()
+		release(cw.encoding, cw.c.Level, cw.w)
+		cw.compressed = false
+		return err
+	}
+	return nil
+}
+
+//Flush sends any buffered data to the client
+func (cw *compressWriter) Flush() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if cw.compressed {
+		if f, ok := cw.w.(interface{ Flush() error }); ok {
+			f.Flush()
+		}
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Hijack implements the http.Hijacker interface, it's failed after the response is written
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if cw.decided || len(cw.buf) > 0 {
+		return nil, nil, errors.New("response has been written")
+	}
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("not support http hijacker")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+//Push implements the http.Pusher interface
+func (cw *compressWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := cw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+//compressor return a pooled gzip or deflate writer of level
+func compressor(encoding string, level int, w io.Writer) io.WriteCloser {
+	pools := &gzipPools
+	if encoding == "deflate" {
+		pools = &flatePools
+	}
+	p, _ := pools.LoadOrStore(level, &sync.Pool{})
+	pool := p.(*sync.Pool)
+	if encoding == "deflate" {
+		if v, ok := pool.Get().(*flate.Writer); ok {
+			v.Reset(w)
+			return v
+		}
+		v, err := flate.NewWriter(w, level)
+		if err != nil {
+			v, _ = flate.NewWriter(w, flate.DefaultCompression)
+		}
+		return v
+	}
+	if v, ok := pool.Get().(*gzip.Writer); ok {
+		v.Reset(w)
+		return v
+	}
+	v, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		v = gzip.NewWriter(w)
+	}
+	return v
+}
+
+//release put the writer back to pool
+func release(encoding string, level int, w io.WriteCloser) {
+	pools := &gzipPools
+	if encoding == "deflate" {
+		pools = &flatePools
+	}
+	if p, ok := pools.Load(level); ok {
+		p.(*sync.Pool).Put(w)
+	}
+}
@@ -4,21 +4,28 @@ package conf
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/axfor/bast/auth/jwt"
+	"github.com/axfor/bast/cache"
 	"github.com/axfor/bast/ids"
 	"github.com/axfor/bast/logs"
+	"github.com/axfor/bast/ratelimit"
 	sessionConf "github.com/axfor/bast/session/conf"
 )
 
 var (
 	flagConf, flagAppKey string
-	confObj              *AppConfMgr
+	confObj              atomic.Value //*AppConfMgr, it's swapped by Reload while the handlers read it
+	confMu               sync.Mutex   //serialize Init and Reload
 	confHandle           ConfingHandle
 	confFinishHandle     FinishHandle
 )
@@ -46,31 +53,51 @@ type AppConf struct {
 	FileDir      string            `json:"fileDir"`
 	Debug        bool              `json:"debug"`
 	BaseURL      string            `json:"baseUrl"`
-	IDNode       uint8             `json:"idNode"`    //id node
-	Lang         string            `json:"lang"`      //lang
-	Trans        string            `json:"trans"`     //trans
-	SameSiteText string            `json:"sameSite"`  //strict|lax|none
-	Wrap         *bool             `json:"wrap"`      //wrap response body
-	Session      *sessionConf.Conf `json:"session"`   //session
-	Log          *logs.Conf        `json:"log"`       //log conf
-	CORS         *CORSConf         `json:"cors"`      //CORS
-	Conf         interface{}       `json:"conf"`      //user conf
-	Extend       string            `json:"extend"`    //user extend
-	Page         *PaginationConf   `json:"page"`      //pagination conf
-	Registry     *RegistryConf     `json:"registry"`  //service registry center
-	Discovery    *DiscoveryConf    `json:"discovery"` //service discovery center
-	Shutdown     int64             `json:"shutdown"`  //service shutdown timeout(default 60 second)
+	IDNode       uint8             `json:"idNode"`       //id node(the id node of work process is idNode + worker index, they must not overlap across app configs)
+	Workers      int               `json:"workers"`      //count of work processes(default is 1)
+	ReusePort    bool              `json:"reusePort"`    //work processes listen with SO_REUSEPORT(linux), default is the listener of master
+	SocketMode   string            `json:"socketMode"`   //file mode of unix socket(addr such as: unix:/run/app.sock), such as: 0660
+	Lang         string            `json:"lang"`         //lang
+	Trans        string            `json:"trans"`        //trans
+	SameSiteText string            `json:"sameSite"`     //strict|lax|none
+	Wrap         *bool             `json:"wrap"`         //wrap response body
+	Session      *sessionConf.Conf `json:"session"`      //session
+	Log          *logs.Conf        `json:"log"`          //log conf
+	CORS         *CORSConf         `json:"cors"`         //CORS
+	Conf         interface{}       `json:"conf"`         //user conf
+	Extend       string            `json:"extend"`       //user extend
+	Page         *PaginationConf   `json:"page"`         //pagination conf
+	Registry     *RegistryConf     `json:"registry"`     //service registry center
+	Discovery    *DiscoveryConf    `json:"discovery"`    //service discovery center
+	JWT          *jwt.Conf         `json:"jwt"`          //jwt authorization
+	Realm        string            `json:"realm"`        //realm of the default WWW-Authenticate challenge(default is app name)
+	RBAC         *RBACConf         `json:"rbac"`         //role and permission based access control
+	OpenAPI      *OpenAPIConf      `json:"openapi"`      //OpenAPI document
+	RateLimit    *ratelimit.Conf   `json:"rateLimit"`    //rate limit
+	Compress     *CompressConf     `json:"compress"`     //response compression
+	ETag         bool              `json:"etag"`         //weak ETag of response body
+	Cache        *cache.Conf       `json:"cache"`        //response cache store
+	Metrics      *MetricsConf      `json:"metrics"`      //prometheus metrics
+	Health       *HealthConf       `json:"health"`       //liveness and readiness
+	DebugRouter  *DebugConf        `json:"debugRouter"`  //pprof and runtime debug routes
+	Restart      *RestartConf      `json:"restart"`      //restart of crashed work processes
+	Timeout      int64             `json:"timeout"`      //handle timeout(millisecond), 0 is unlimited
+	ReadTimeout  int64             `json:"readTimeout"`  //server read timeout(millisecond), 0 is unlimited
+	WriteTimeout int64             `json:"writeTimeout"` //server write timeout(millisecond), 0 is unlimited
+	Shutdown     int64             `json:"shutdown"`     //service shutdown timeout(default 60 second)
 	SameSite     http.SameSite     `json:"-"`
 	initTag      bool
 }
 
 //CORSConf  config
 type CORSConf struct {
-	AllowOrigin      string `json:"allowOrigin"`
-	AllowMethods     string `json:"allowMethods"`
-	AllowHeaders     string `json:"allowHeaders"`
-	AllowCredentials string `json:"allowCredentials"`
-	MaxAge           string `json:"maxAge"`
+	AllowOrigin      string   `json:"allowOrigin"`      //allowed origins split by ',', exact, wildcard(such as: https://*.example.com) or *
+	AllowOriginRegex []string `json:"allowOriginRegex"` //allowed origin regexps, they match the full origin
+	AllowMethods     string   `json:"allowMethods"`
+	AllowHeaders     string   `json:"allowHeaders"` //* is any request headers
+	ExposeHeaders    string   `json:"exposeHeaders"`
+	AllowCredentials string   `json:"allowCredentials"`
+	MaxAge           string   `json:"maxAge"`
 }
 
 //PaginationConf  config
@@ -80,6 +107,74 @@ type PaginationConf struct {
 	PageRow string `json:"pageRow"`
 }
 
+//RBACConf  config
+type RBACConf struct {
+	DenyDefault bool                `json:"denyDefault"` //deny the authorization routes without roles or permissions
+	Roles       map[string][]string `json:"roles"`       //role permissions, such as: {"admin":["user:read","user:write"]}
+	Rules       []RBACRule          `json:"rules"`       //route rules
+}
+
+//RBACRule  route rule of RBACConf
+type RBACRule struct {
+	Method      string   `json:"method"`      //GET
+	Pattern     string   `json:"pattern"`     //such as: /api/users/:id
+	Roles       []string `json:"roles"`       //any-of roles
+	Permissions []string `json:"permissions"` //all-of permissions
+}
+
+//OpenAPIConf  config
+type OpenAPIConf struct {
+	Enable      bool     `json:"enable"`      //serve OpenAPI document
+	Path        string   `json:"path"`        //document path(default /openapi.json), .yaml is yaml document
+	Title       string   `json:"title"`       //default is app name
+	Version     string   `json:"version"`     //default is 1.0.0
+	Description string   `json:"description"` //
+	UI          string   `json:"ui"`          //api explorer path(such as: /docs), only for debug or authorization schemes
+	Auth        []string `json:"auth"`        //authorization schemes of api explorer
+}
+
+//MetricsConf  config
+type MetricsConf struct {
+	Enable bool     `json:"enable"` //serve metrics and instrument routes
+	Path   string   `json:"path"`   //metrics path(default /metrics)
+	Auth   []string `json:"auth"`   //authorization schemes of metrics
+}
+
+//HealthConf  config
+type HealthConf struct {
+	Enable    bool   `json:"enable"`    //serve liveness and readiness
+	Liveness  string `json:"liveness"`  //liveness path(default /healthz)
+	Readiness string `json:"readiness"` //readiness path(default /readyz)
+	Timeout   int64  `json:"timeout"`   //timeout of checks(millisecond), default is 3000
+	Drain     int64  `json:"drain"`     //wait time(millisecond) after readiness is not-ready in shutdown
+}
+
+//DebugConf  config
+type DebugConf struct {
+	Enable   bool     `json:"enable"`   //serve pprof, expvar, goroutines, gc and conf
+	Prefix   string   `json:"prefix"`   //path prefix(default /debug)
+	Addr     string   `json:"addr"`     //admin listen address(such as: 127.0.0.1:6060), empty is the app address, it is served by the first work process
+	Auth     []string `json:"auth"`     //authorization schemes of debug routes on the app address
+	UserConf bool     `json:"userConf"` //show the user config(conf) in /conf, it's masked as the other values
+}
+
+//RestartConf  config
+type RestartConf struct {
+	Disable    bool  `json:"disable"`    //disable restart of crashed work processes
+	Backoff    int64 `json:"backoff"`    //backoff(millisecond) of first restart, it's doubled for each crash in window(default 1000)
+	MaxBackoff int64 `json:"maxBackoff"` //max backoff(millisecond), default is 30000
+	MaxCrashes int   `json:"maxCrashes"` //give up restarting when the crashes in window are more than it(default 5)
+	Window     int64 `json:"window"`     //crash window(second), default is 60
+}
+
+//CompressConf  config
+type CompressConf struct {
+	Enable  bool     `json:"enable"`  //compress the response of all routes
+	Level   int      `json:"level"`   //1(best speed)-9(best compression), default is 6
+	MinSize int      `json:"minSize"` //min response size to compress(default is 1024 byte)
+	Types   []string `json:"types"`   //content types to compress, such as: application/json or text/*(default is json,xml,yaml,text)
+}
+
 //RegistryConf  config
 type RegistryConf struct {
 	Enable      bool   `json:"enable"`    //
@@ -100,61 +195,95 @@ type DiscoveryConf struct {
 
 //Init data
 func Init() {
-	if confObj == nil {
-		data, err := ioutil.ReadFile(Path())
-		if err != nil {
-			logs.Errors("read conf error", err)
-			return
-		}
-		s := strings.TrimSpace(string(data))
-		isAdd := (s[0] != '[')
-		if isAdd && s[0] != '{' {
-			s = "{" + s + "}"
-		}
-		if isAdd {
-			s = "[" + s + "]"
-			data = []byte(s)
-		}
-		appConf := []AppConf{}
-		err = json.Unmarshal(data, &appConf)
-		if err != nil {
-			logs.Errors("conf manager init error", err)
-			return
-		}
-		if confObj != nil {
-			return
-		}
-		confObj = &AppConfMgr{}
-		confObj.rawConfs = appConf
-		confObj.Confs = make(map[string]*AppConf)
-		lg := len(appConf)
-		if lg > 0 {
-			for i := 0; i < lg; i++ {
-				c := &appConf[i]
-				appConfWithInit(c)
-				if c.Key == flagAppKey && confObj.frist == nil {
-					confObj.frist = c
-				}
-				confObj.Confs[c.Key] = c
-			}
-			if confObj.frist == nil {
-				confObj.frist = &appConf[0]
-			}
-			//set default current id node
-			if confObj.frist != nil {
-				ids.SetIDNode(confObj.frist.IDNode)
-			}
-			callbackHandle()
+	if manager() != nil {
+		return
+	}
+	confMu.Lock()
+	defer confMu.Unlock()
+	if manager() != nil {
+		return
+	}
+	m, err := load()
+	if err != nil {
+		logs.Errors("conf manager init error", err)
+		return
+	}
+	confObj.Store(m)
+	//set default current id node
+	if m.frist != nil {
+		ids.SetIDNode(m.frist.IDNode)
+	}
+	callbackHandle()
+}
+
+//load read and parse the config file
+func load() (*AppConfMgr, error) {
+	data, err := ioutil.ReadFile(Path())
+	if err != nil {
+		return nil, err
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "" {
+		return nil, errors.New("empty conf")
+	}
+	isAdd := (s[0] != '[')
+	if isAdd && s[0] != '{' {
+		s = "{" + s + "}"
+	}
+	if isAdd {
+		s = "[" + s + "]"
+		data = []byte(s)
+	}
+	appConf := []AppConf{}
+	if err = json.Unmarshal(data, &appConf); err != nil {
+		return nil, err
+	}
+	m := &AppConfMgr{}
+	m.rawConfs = appConf
+	m.Confs = make(map[string]*AppConf)
+	for i := range appConf {
+		c := &appConf[i]
+		appConfWithInit(c)
+		if c.Key == flagAppKey && m.frist == nil {
+			m.frist = c
 		}
+		m.Confs[c.Key] = c
+	}
+	if m.frist == nil && len(appConf) > 0 {
+		m.frist = &appConf[0]
+	}
+	return m, nil
+}
+
+//Reload read the config file again and swap it atomically, the handles of Register are called again
+//the old config is kept when it's failed.
+//only the values which are read by Conf(such as lang, trans and user config) per request and the handles of Register
+//are reloaded, the listeners, workers, session, CORS, cache, rate limit, jwt and health are kept until the work processes are reloaded
+func Reload() error {
+	confMu.Lock()
+	defer confMu.Unlock()
+	m, err := load()
+	if err != nil {
+		return errors.New("reload conf failed, detail:" + err.Error())
 	}
+	confObj.Store(m)
+	callbackHandle()
+	return nil
+}
+
+//manager return the loaded config, nil is not loaded
+func manager() *AppConfMgr {
+	m, _ := confObj.Load().(*AppConfMgr)
+	return m
 }
 
 //Manager is manager all config objects
 func Manager() *AppConfMgr {
-	if confObj == nil {
-		Init()
+	if m := manager(); m != nil {
+		return m
 	}
-	return confObj
+	Init()
+	return manager()
 }
 
 func appConfWithInit(c *AppConf) {
@@ -194,6 +323,7 @@ func appConfWithInit(c *AppConf) {
 
 //callback all handle
 func callbackHandle() {
+	confObj := manager()
 	if confObj == nil {
 		return
 	}
@@ -348,6 +478,162 @@ func Discovery() *DiscoveryConf {
 	return nil
 }
 
+//JWT return jwt conf
+func JWT() *jwt.Conf {
+	c := Conf()
+	if c != nil {
+		return c.JWT
+	}
+	return nil
+}
+
+//RBAC return role and permission based access control conf
+func RBAC() *RBACConf {
+	c := Conf()
+	if c != nil && c.RBAC != nil {
+		return c.RBAC
+	}
+	return &RBACConf{}
+}
+
+//RateLimit return rate limit conf
+func RateLimit() *ratelimit.Conf {
+	c := Conf()
+	if c != nil && c.RateLimit != nil {
+		return c.RateLimit
+	}
+	return &ratelimit.Conf{}
+}
+
+//Compress return response compression conf
+func Compress() *CompressConf {
+	c := Conf()
+	if c != nil && c.Compress != nil {
+		return CompressDefault(c.Compress)
+	}
+	return CompressDefault(&CompressConf{})
+}
+
+//ETag return the weak ETag of response body is enabled
+func ETag() bool {
+	c := Conf()
+	return c != nil && c.ETag
+}
+
+//CompressDefault fill the default level, min size and types of c
+func CompressDefault(c *CompressConf) *CompressConf {
+	if c.Level < 1 || c.Level > 9 {
+		c.Level = 6
+	}
+	if c.MinSize <= 0 {
+		c.MinSize = 1024
+	}
+	if len(c.Types) == 0 {
+		c.Types = []string{"application/json", "application/xml", "application/x+yaml", "application/javascript", "text/*"}
+	}
+	return c
+}
+
+//Cache return response cache conf
+func Cache() *cache.Conf {
+	c := Conf()
+	if c != nil && c.Cache != nil {
+		return c.Cache
+	}
+	return &cache.Conf{}
+}
+
+//Metrics return prometheus metrics conf
+func Metrics() *MetricsConf {
+	m := &MetricsConf{}
+	c := Conf()
+	if c != nil && c.Metrics != nil {
+		m = c.Metrics
+	}
+	if m.Path == "" {
+		m.Path = "/metrics"
+	}
+	return m
+}
+
+//Health return liveness and readiness conf
+func Health() *HealthConf {
+	h := &HealthConf{}
+	c := Conf()
+	if c != nil && c.Health != nil {
+		h = c.Health
+	}
+	if h.Liveness == "" {
+		h.Liveness = "/healthz"
+	}
+	if h.Readiness == "" {
+		h.Readiness = "/readyz"
+	}
+	return h
+}
+
+//RestartOf return the restart conf of app conf(the master has all app confs)
+func RestartOf(c *AppConf) *RestartConf {
+	r := RestartConf{}
+	if c != nil && c.Restart != nil {
+		r = *c.Restart
+	}
+	if r.Backoff <= 0 {
+		r.Backoff = 1000
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = 30000
+	}
+	if r.MaxBackoff < r.Backoff {
+		r.MaxBackoff = r.Backoff
+	}
+	if r.MaxCrashes <= 0 {
+		r.MaxCrashes = 5
+	}
+	if r.Window <= 0 {
+		r.Window = 60
+	}
+	return &r
+}
+
+//DebugRouter return pprof and runtime debug routes conf
+func DebugRouter() *DebugConf {
+	d := &DebugConf{}
+	c := Conf()
+	if c != nil && c.DebugRouter != nil {
+		d = c.DebugRouter
+	}
+	if d.Prefix == "" {
+		d.Prefix = "/debug"
+	}
+	return d
+}
+
+//OpenAPI return OpenAPI document conf
+func OpenAPI() *OpenAPIConf {
+	var o *OpenAPIConf
+	c := Conf()
+	if c != nil && c.OpenAPI != nil {
+		o = c.OpenAPI
+	}
+	if o == nil {
+		o = &OpenAPIConf{}
+	}
+	if o.Path == "" {
+		o.Path = "/openapi.json"
+	}
+	if o.Title == "" {
+		o.Title = filepath.Base(os.Args[0])
+		if c != nil && c.Name != "" {
+			o.Title = c.Name
+		}
+	}
+	if o.Version == "" {
+		o.Version = "1.0.0"
+	}
+	return o
+}
+
 //SameSite if app config configuration cookie sameSite return it，orherwise return 'None'
 func SameSite() http.SameSite {
 	c := Conf()
@@ -386,31 +672,30 @@ func Log() *logs.Conf {
 	return nil
 }
 
-//CORS  returns the current log config
+//CORS  returns the current CORS config
 func CORS() *CORSConf {
 	appConf := Conf()
 	if appConf != nil && appConf.CORS != nil {
-		if appConf.CORS.AllowMethods == "" {
-			appConf.CORS.AllowMethods = "GET, POST, OPTIONS, PATCH, PUT, DELETE, HEAD,UPDATE"
-		}
-		if appConf.CORS.AllowHeaders == "" {
-			appConf.CORS.AllowHeaders = "Authorization, Content-Length, X-CSRF-Token, Token,session,X_Requested_With,Accept, Origin, Host, Connection, Accept-Encoding, Accept-Language,DNT, X-CustomHeader, Keep-Alive, User-Agent, X-Requested-With, If-Modified-Since, Cache-Control, Content-Type, Pragma, BaseUrl, baseurl"
-		}
-		if appConf.CORS.AllowCredentials == "" {
-			appConf.CORS.AllowCredentials = "true"
-		}
-		if appConf.CORS.MaxAge == "" {
-			appConf.CORS.MaxAge = "1728000"
-		}
-		return appConf.CORS
+		return CORSDefault(appConf.CORS)
+	}
+	return CORSDefault(&CORSConf{})
+}
+
+//CORSDefault fill the default methods, headers, credentials and max age of c
+func CORSDefault(c *CORSConf) *CORSConf {
+	if c.AllowMethods == "" {
+		c.AllowMethods = "GET, POST, OPTIONS, PATCH, PUT, DELETE, HEAD,UPDATE"
 	}
-	return &CORSConf{
-		AllowOrigin:      "",
-		AllowMethods:     "GET, POST, OPTIONS, PATCH, PUT, DELETE, HEAD,UPDATE",
-		AllowHeaders:     "Authorization, Content-Length, X-CSRF-Token, Token,session,X_Requested_With,Accept, Origin, Host, Connection, Accept-Encoding, Accept-Language,DNT, X-CustomHeader, Keep-Alive, User-Agent, X-Requested-With, If-Modified-Since, Cache-Control, Content-Type, Pragma, BaseUrl, baseurl",
-		AllowCredentials: "true",
-		MaxAge:           "1728000",
+	if c.AllowHeaders == "" {
+		c.AllowHeaders = "Authorization, Content-Length, X-CSRF-Token, Token,session,X_Requested_With,Accept, Origin, Host, Connection, Accept-Encoding, Accept-Language,DNT, X-CustomHeader, Keep-Alive, User-Agent, X-Requested-With, If-Modified-Since, If-None-Match, If-Match, If-Unmodified-Since, X-Request-ID, Cache-Control, Content-Type, Pragma, BaseUrl, baseurl"
 	}
+	if c.AllowCredentials == "" {
+		c.AllowCredentials = "true"
+	}
+	if c.MaxAge == "" {
+		c.MaxAge = "1728000"
+	}
+	return c
 }
 
 //Wrap  wrap response body
@@ -451,6 +736,48 @@ func Register(handle ConfingHandle, finish ...FinishHandle) {
 	callbackHandle()
 }
 
+//Realm returns realm of the default WWW-Authenticate challenge
+func Realm() string {
+	c := Conf()
+	if c == nil {
+		return "bast"
+	}
+	if c.Realm != "" {
+		return c.Realm
+	}
+	if c.Name != "" {
+		return c.Name
+	}
+	return "bast"
+}
+
+//Timeout returns handle timeout
+func Timeout() time.Duration {
+	c := Conf()
+	if c != nil && c.Timeout > 0 {
+		return time.Duration(c.Timeout) * time.Millisecond
+	}
+	return 0
+}
+
+//ReadTimeout returns server read timeout
+func ReadTimeout() time.Duration {
+	c := Conf()
+	if c != nil && c.ReadTimeout > 0 {
+		return time.Duration(c.ReadTimeout) * time.Millisecond
+	}
+	return 0
+}
+
+//WriteTimeout returns server write timeout
+func WriteTimeout() time.Duration {
+	c := Conf()
+	if c != nil && c.WriteTimeout > 0 {
+		return time.Duration(c.WriteTimeout) * time.Millisecond
+	}
+	return 0
+}
+
 //Shutdown returns service shutdown timeout
 func Shutdown() time.Duration {
 	c := Conf()
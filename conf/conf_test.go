@@ -18,3 +18,29 @@ func TestConf(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestReload(t *testing.T) {
+	SetPath("../config.conf")
+	old := Conf()
+	//the handlers read the config while it's reloaded(go test -race)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if Conf() == nil {
+				t.Error("conf is nil in reload")
+				return
+			}
+		}
+	}()
+	if err := Reload(); err != nil || Conf() == nil || Conf() == old || Conf().Key != old.Key {
+		t.Fatal(err)
+	}
+	<-done
+	SetPath("../not-exist.conf")
+	defer SetPath("../config.conf")
+	c := Conf()
+	if err := Reload(); err == nil || Conf() != c {
+		t.Fatal(err)
+	}
+}
@@ -19,10 +19,12 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/axfor/bast/auth/jwt"
 	"github.com/axfor/bast/conf"
 	"github.com/axfor/bast/guid"
 	"github.com/axfor/bast/lang"
 	"github.com/axfor/bast/logs"
+	"github.com/axfor/bast/ratelimit"
 	"github.com/axfor/bast/session/engine"
 	"github.com/axfor/bast/validate"
 	"github.com/julienschmidt/httprouter"
@@ -69,12 +71,28 @@ type Context struct {
 	Params httprouter.Params
 	//isParseForm Parse tag
 	isParseForm bool
+	//status is the status code of the next output
+	status int
 	//NeedAuthorization is need authorization
 	NeedAuthorization bool
 	//IsAuthorization is authorization finish?
 	IsAuthorization bool
 	//Session is session
 	Session engine.Store
+	//claims is verified jwt claims
+	claims jwt.Claims
+	//principal is the current user(see Policy)
+	principal *Principal
+	//rateLimit is the most restrictive rate limit of request
+	rateLimit *ratelimit.Result
+	//requestID is the X-Request-ID of request
+	requestID string
+	//etag is the ETag of the next output(see ETag)
+	etag string
+	//cacheTags is the tags of the cached response(see Pattern.Cache)
+	cacheTags []string
+	//log is the logger of request
+	log *logs.Log
 	//Router
 	Router *Pattern
 }
@@ -257,11 +275,15 @@ func (c *Context) JSONWithPageCodeMsg(v interface{}, page, total, code int, msg
 func (c *Context) JSONResult(v interface{}) {
 	data, err := json.Marshal(v)
 	if err != nil {
-		logs.Errors("JSONResult error", err)
+		c.Log().Errors("JSONResult error", err)
 		c.StatusCode(http.StatusInternalServerError)
 		return
 	}
 	c.Out.Header().Set("Content-Type", "application/json")
+	if c.notModified(data) {
+		return
+	}
+	c.writeStatus()
 	c.Out.Write(data)
 	data = nil
 }
@@ -329,11 +351,15 @@ func (c *Context) XMLWithPageCodeMsg(v interface{}, page, total, code int, msg s
 func (c *Context) XMLResult(v interface{}) {
 	data, err := xml.Marshal(v)
 	if err != nil {
-		logs.Errors("XMLResult error", err)
+		c.Log().Errors("XMLResult error", err)
 		c.StatusCode(http.StatusInternalServerError)
 		return
 	}
 	c.Out.Header().Set("Content-Type", "application/xml")
+	if c.notModified(data) {
+		return
+	}
+	c.writeStatus()
 	c.Out.Write(data)
 	data = nil
 }
@@ -401,11 +427,15 @@ func (c *Context) YAMLWithPageCodeMsg(v interface{}, page, total, code int, msg
 func (c *Context) YAMLResult(v interface{}) {
 	data, err := yaml.Marshal(v)
 	if err != nil {
-		logs.Errors("YAMLResult error", err)
+		c.Log().Errors("YAMLResult error", err)
 		c.StatusCode(http.StatusInternalServerError)
 		return
 	}
 	c.Out.Header().Set("Content-Type", "application/x+yaml")
+	if c.notModified(data) {
+		return
+	}
+	c.writeStatus()
 	c.Out.Write(data)
 	data = nil
 }
@@ -641,6 +671,7 @@ func (c *Context) NoData(msg string) {
 //param:
 //	data raw bytes
 func (c *Context) Say(data []byte) {
+	c.writeStatus()
 	c.Out.Write(data)
 }
 
@@ -648,6 +679,7 @@ func (c *Context) Say(data []byte) {
 //param:
 //	str string
 func (c *Context) Says(str string) {
+	c.writeStatus()
 	c.Out.Write([]byte(str))
 }
 
@@ -720,6 +752,21 @@ func (c *Context) StatusCode(statusCode int) {
 	c.Out.Write([]byte(http.StatusText(statusCode)))
 }
 
+//Status set current request statusCode of the next output(JSON/XML/YAML/Say etc.)
+//param:
+//	statusCode HTTP status code. such as: 200x,300x and so on
+func (c *Context) Status(statusCode int) {
+	c.status = statusCode
+}
+
+//writeStatus write the status code which is set by Status
+func (c *Context) writeStatus() {
+	if c.status != 0 {
+		c.Out.WriteHeader(c.status)
+		c.status = 0
+	}
+}
+
 //RawString getter raw string value from current request(request body)
 func (c *Context) RawString() string {
 	body, err := ioutil.ReadAll(c.In.Body)
@@ -1083,7 +1130,7 @@ func (c *Context) JSONDecode(r io.Reader, obj interface{}) (err error) {
 	if app.Debug {
 		body, err := ioutil.ReadAll(r)
 		if err != nil {
-			logs.Debug("JSONDecode error", logs.Err(err), logs.ByteString("detail", body))
+			c.Log().Debug("JSONDecode error", logs.Err(err), logs.ByteString("detail", body))
 			return err
 		}
 		err = json.Unmarshal(body, obj)
@@ -1092,7 +1139,7 @@ func (c *Context) JSONDecode(r io.Reader, obj interface{}) (err error) {
 		err = json.NewDecoder(r).Decode(obj)
 	}
 	if err != nil {
-		logs.Debug("JSONDecode error", logs.Err(err))
+		c.Log().Debug("JSONDecode error", logs.Err(err))
 	}
 	return err
 }
@@ -1117,7 +1164,7 @@ func (c *Context) XMLDecode(r io.Reader, obj interface{}) (err error) {
 	if app.Debug {
 		body, err := ioutil.ReadAll(r)
 		if err != nil {
-			logs.Debug("XMLDecode error", logs.Err(err), logs.ByteString("detail", body))
+			c.Log().Debug("XMLDecode error", logs.Err(err), logs.ByteString("detail", body))
 			return err
 		}
 		err = xml.Unmarshal(body, obj)
@@ -1126,7 +1173,7 @@ func (c *Context) XMLDecode(r io.Reader, obj interface{}) (err error) {
 		err = xml.NewDecoder(r).Decode(obj)
 	}
 	if err != nil {
-		logs.Debug("XMLDecode error", logs.Err(err))
+		c.Log().Debug("XMLDecode error", logs.Err(err))
 	}
 	return err
 }
@@ -1151,7 +1198,7 @@ func (c *Context) YAMLDecode(r io.Reader, obj interface{}) (err error) {
 	if app.Debug {
 		body, err := ioutil.ReadAll(r)
 		if err != nil {
-			logs.Debug("YAMLDecode error", logs.Err(err), logs.ByteString("detail", body))
+			c.Log().Debug("YAMLDecode error", logs.Err(err), logs.ByteString("detail", body))
 			return err
 		}
 		err = yaml.Unmarshal(body, obj)
@@ -1160,7 +1207,7 @@ func (c *Context) YAMLDecode(r io.Reader, obj interface{}) (err error) {
 		err = yaml.NewDecoder(r).Decode(obj)
 	}
 	if err != nil {
-		logs.Debug("YAMLDecode error", logs.Err(err))
+		c.Log().Debug("YAMLDecode error", logs.Err(err))
 	}
 	return err
 }
@@ -1170,7 +1217,7 @@ func (c *Context) MapObj() map[string]interface{} {
 	result := make(map[string]interface{})
 	err := c.Obj(result)
 	if err != nil {
-		logs.Debug("MapObj error", logs.Err(err))
+		c.Log().Debug("MapObj error", logs.Err(err))
 		return nil
 	}
 	return result
@@ -1227,6 +1274,19 @@ func (c *Context) SessionWrite(key string, value interface{}) error {
 	return nil
 }
 
+//Claims return the verified jwt claims of current request(see JWT)
+func (c *Context) Claims() jwt.Claims {
+	return c.claims
+}
+
+//SignJWT create a signed jwt token of claims(see JWT)
+func (c *Context) SignJWT(claims jwt.Claims) (string, error) {
+	if app.jwt == nil {
+		return "", errors.New("jwt is not configured")
+	}
+	return app.jwt.Sign(claims)
+}
+
 //SessionDelete delete session value by key
 func (c *Context) SessionDelete(key string) error {
 	if c.Session != nil {
@@ -1339,9 +1399,17 @@ func (c *Context) Reset() {
 	c.Out = nil
 	c.Params = nil
 	c.isParseForm = false
+	c.status = 0
 	c.NeedAuthorization = false
 	c.IsAuthorization = false
 	c.Session = nil
+	c.claims = nil
+	c.principal = nil
+	c.rateLimit = nil
+	c.requestID = ""
+	c.etag = ""
+	c.cacheTags = nil
+	c.log = nil
 	c.Accept = ""
 	c.KindAccept = 0
 	c.Router = nil
@@ -0,0 +1,355 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/logs"
+	"github.com/axfor/bast/pipe"
+)
+
+//controlTimeout is the timeout of control requests between master and work processes
+const controlTimeout = 5 * time.Second
+
+//the commands of control protocol(see pipe.Message)
+const (
+	cmdReady  = "ready"  //work -> master, data is pid of work process
+	cmdStatus = "status" //status of master or work process
+	cmdStop   = "stop"   //graceful stop master(and all work processes) or work process
+	cmdReload = "reload" //master reload work processes
+	cmdConf   = "conf"   //reload config of work processes(see conf.Reload)
+	cmdLog    = "log"    //set log level of work processes, data is level
+	cmdStats  = "stats"  //runtime stats of work processes
+)
+
+//WorkResult is the result of a command which is sent to a work process by master(see --log, --stats and --reload-conf)
+type WorkResult struct {
+	Pid    int             `json:"pid"`
+	Key    string          `json:"key"`
+	Worker int             `json:"worker"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+//MasterStatus is the status of master
+type MasterStatus struct {
+	Pid   int          `json:"pid"`
+	Works []WorkStatus `json:"works"`
+}
+
+//WorkStatus is the status of work process
+type WorkStatus struct {
+	Pid      int       `json:"pid"`
+	Key      string    `json:"key"`
+	Worker   int       `json:"worker"` //index in the work processes of app key
+	Runing   bool      `json:"runing"`
+	Restarts int       `json:"restarts"`
+	State    string    `json:"state"` //running|restarting|failed|stopped
+	Addr     string    `json:"addr,omitempty"`
+	Start    time.Time `json:"start,omitempty"`
+	Uptime   string    `json:"uptime,omitempty"`
+	InFlight int64     `json:"inFlight"` //count of requests which are serving
+	Version  string    `json:"version,omitempty"`
+	Error    string    `json:"error,omitempty"` //the work process is not responding(see --status)
+}
+
+//master is the state of the check loop of work processes(see checkWorkProcess)
+type master struct {
+	exits    chan *exec.Cmd
+	expired  chan int
+	calls    chan func()
+	restarts chan int      //index of work process which is restarted after backoff
+	quit     chan struct{} //closed when the check loop is exited
+	reloads  reloading
+	stopping bool
+	notified bool //READY=1 is sent to systemd
+}
+
+//newMaster create the state of check loop
+func newMaster() *master {
+	return &master{exits: make(chan *exec.Cmd), expired: make(chan int), calls: make(chan func()), restarts: make(chan int), quit: make(chan struct{}), reloads: reloading{}}
+}
+
+//wait send the cmd to exits when it's exited
+func (m *master) wait(cmd *exec.Cmd) {
+	go func() {
+		cmd.Wait()
+		m.exits <- cmd
+	}()
+}
+
+//reload start new work processes and stop the old ones when they are ready
+func (m *master) reload() error {
+	if !handoff() {
+		return errors.New("reload is not supported on windows")
+	}
+	if m.stopping {
+		return errors.New("master is stopping")
+	}
+	logs.Info("reload work processes")
+	systemd.reloading()
+	m.notified = false
+	reloadWorks(m.reloads, m.wait, m.expired)
+	return nil
+}
+
+//stop stop all work processes gracefully, the check loop is finished when they are exited
+func (m *master) stop() {
+	m.stopping = true
+	systemd.notify("STOPPING=1")
+	for pid := range m.reloads {
+		m.reloads.abort(pid, "master stopping")
+	}
+	for i := range app.cmd {
+		w := &app.cmd[i]
+		//the work processes which are waiting to restart are not started
+		w.restarting = false
+		if w.runing {
+			//the work processes are stopped concurrently out of the check loop
+			go stopWork(w.cmd.Process.Pid)
+		}
+	}
+}
+
+//status return the status of master
+func (m *master) status() *MasterStatus {
+	s := &MasterStatus{Pid: os.Getpid(), Works: []WorkStatus{}}
+	for _, w := range app.cmd {
+		ws := WorkStatus{Key: w.key, Worker: w.index, Runing: w.runing, Restarts: w.exitCount, State: w.state()}
+		if w.cmd != nil && w.cmd.Process != nil {
+			ws.Pid = w.cmd.Process.Pid
+		}
+		s.Works = append(s.Works, ws)
+	}
+	return s
+}
+
+//control handle the control requests of master, it's called in the check loop
+func (m *master) control(req *pipe.Message) (interface{}, error) {
+	switch req.Cmd {
+	case cmdReady:
+		var pid int
+		if err := json.Unmarshal(req.Data, &pid); err != nil {
+			return nil, err
+		}
+		m.reloads.ready(pid)
+		m.ready(pid)
+		return nil, nil
+	case cmdStatus:
+		return m.status(), nil
+	case cmdStop:
+		m.stop()
+		return nil, nil
+	case cmdReload:
+		return nil, m.reload()
+	}
+	return nil, errors.New("unknown command " + req.Cmd)
+}
+
+//serve listen the control pipe of master, the requests are handled in the check loop
+func (m *master) serve() error {
+	l, err := pipe.Listen(app.pipeName)
+	if err != nil {
+		return err
+	}
+	app.pipe = l
+	go pipe.Serve(l, func(req *pipe.Message) (interface{}, error) {
+		switch req.Cmd {
+		case cmdConf, cmdLog, cmdStats:
+			//the work processes are called out of the check loop
+			v, err := m.call(func() (interface{}, error) {
+				return m.status(), nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			return fanout(app.pipeName, v.(*MasterStatus).Works, req), nil
+		}
+		return m.call(func() (interface{}, error) {
+			return m.control(req)
+		})
+	})
+	return nil
+}
+
+//call run f in the check loop, it's failed when the check loop is busy or f is not finished in controlTimeout
+func (m *master) call(f func() (interface{}, error)) (interface{}, error) {
+	type result struct {
+		v   interface{}
+		err error
+	}
+	done := make(chan result, 1)
+	timeout := time.NewTimer(controlTimeout)
+	defer timeout.Stop()
+	select {
+	case m.calls <- func() {
+		v, err := f()
+		done <- result{v, err}
+	}:
+	case <-timeout.C:
+		return nil, errors.New("master is busy or exited")
+	}
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-timeout.C:
+		return nil, errors.New("master is busy")
+	}
+}
+
+//fanout send the request to the running work processes concurrently and return their results
+func fanout(master string, works []WorkStatus, req *pipe.Message) []WorkResult {
+	rs := []WorkResult{}
+	for _, w := range works {
+		if w.Runing && w.Pid > 0 {
+			rs = append(rs, WorkResult{Pid: w.Pid, Key: w.Key, Worker: w.Worker})
+		}
+	}
+	var data interface{}
+	if len(req.Data) > 0 {
+		data = req.Data
+	}
+	var wg sync.WaitGroup
+	for i := range rs {
+		wg.Add(1)
+		go func(r *WorkResult) {
+			defer wg.Done()
+			if err := pipe.Call(workPipe(master, r.Pid), req.Cmd, data, &r.Data, controlTimeout); err != nil {
+				r.Error = err.Error()
+			}
+		}(&rs[i])
+	}
+	wg.Wait()
+	return rs
+}
+
+//controlWorks send the command to all work processes by master and print the results as json(see --log, --stats and --reload-conf)
+//the exit code is 1 when the master or any work process is failed
+func controlWorks(cmd string, data interface{}) {
+	rs := []WorkResult{}
+	if err := callMaster(cmd, data, &rs); err != nil {
+		fmt.Println(cmd + " error,detail:" + err.Error())
+		os.Exit(1)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(rs)
+	for _, r := range rs {
+		if r.Error != "" {
+			os.Exit(1)
+		}
+	}
+	os.Exit(0)
+}
+
+//workPipe return the control pipe name of work process
+func workPipe(master string, pid int) string {
+	return master + "." + strconv.Itoa(pid)
+}
+
+//serveWork listen the control pipe of work process and tell master it's ready to serve
+func serveWork() {
+	if flagPipe == "" {
+		return
+	}
+	l, err := pipe.Listen(workPipe(flagPipe, os.Getpid()))
+	if err != nil {
+		logs.Errors("work pipe listen failed", err)
+	} else {
+		app.pipe = l
+		go pipe.Serve(l, workControl)
+	}
+	if err := pipe.Call(flagPipe, cmdReady, os.Getpid(), nil, controlTimeout); err != nil {
+		logs.Errors("notify ready failed", err)
+	}
+}
+
+//workControl handle the control requests of work process
+func workControl(req *pipe.Message) (interface{}, error) {
+	switch req.Cmd {
+	case cmdStatus:
+		return &WorkStatus{
+			Pid:      os.Getpid(),
+			Key:      flagAppKey,
+			Worker:   workerIndex(),
+			Runing:   app.runing,
+			Addr:     app.Addr,
+			Start:    app.started,
+			Uptime:   time.Since(app.started).Truncate(time.Second).String(),
+			InFlight: inFlights(),
+			Version:  version(),
+		}, nil
+	case cmdStop:
+		logs.Info("stop by master")
+		go func() {
+			if err := Shutdown(nil); err != nil {
+				logs.Errors("shutdown error", err)
+			}
+		}()
+		return nil, nil
+	case cmdConf:
+		if err := conf.Reload(); err != nil {
+			return nil, err
+		}
+		if c := conf.Log(); c != nil && c.Level != "" {
+			logs.SetLevel(c.Level)
+		}
+		logs.Info("config reloaded")
+		return nil, nil
+	case cmdLog:
+		var level string
+		if err := json.Unmarshal(req.Data, &level); err != nil {
+			return nil, err
+		}
+		if err := logs.SetLevel(level); err != nil {
+			return nil, err
+		}
+		return logs.Level(), nil
+	case cmdStats:
+		return runtimeStats(), nil
+	}
+	return nil, errors.New("unknown command " + req.Cmd)
+}
+
+//stopWork stop the work process gracefully by control pipe, the signal is sent when it's failed
+func stopWork(pid int) error {
+	if err := pipe.Call(workPipe(app.pipeName, pid), cmdStop, nil, nil, controlTimeout); err != nil {
+		logs.Errors("stop work process by pipe failed", err)
+		return sendSignal(syscall.SIGINT, pid)
+	}
+	return nil
+}
+
+//callMaster send a request to the running master(see the pid file)
+func callMaster(cmd string, data, v interface{}) error {
+	name := getMasterPipeWithFile()
+	if name == "" {
+		return errors.New("not found master pipe")
+	}
+	return pipe.Call(name, cmd, data, v, controlTimeout)
+}
+
+//getMasterPipeWithFile return the control pipe name of master form pid log
+func getMasterPipeWithFile() string {
+	data, err := ioutil.ReadFile(os.Args[0] + ".pid")
+	if err != nil {
+		return ""
+	}
+	cs := strings.Split(string(data), "|")
+	if len(cs) < 2 {
+		return ""
+	}
+	return strings.Split(cs[1], ":")[0]
+}
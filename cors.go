@@ -0,0 +1,219 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/logs"
+	"github.com/julienschmidt/httprouter"
+)
+
+//corsPolicy is the compiled CORS config
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	wildcards   [][2]string //prefix and suffix of wildcard origins
+	regexps     []*regexp.Regexp
+	methods     map[string]bool
+	anyMethod   bool
+	allowMethod string
+	allowHeader string
+	anyHeader   bool
+	expose      string
+	maxAge      string
+	credentials bool
+}
+
+//CORS set the CORS policy of api(default is 'cors' of app config)
+func (c *Pattern) CORS(cc *conf.CORSConf) *Pattern {
+	c.cors = newCORS(cc)
+	return c
+}
+
+//CORS set the CORS policy of group routes(see Pattern.CORS)
+func (g *RouterGroup) CORS(cc *conf.CORSConf) *RouterGroup {
+	g.cors = newCORS(cc)
+	return g
+}
+
+//corsPolicy return the CORS policy of pattern
+func (c *Pattern) corsPolicy() *corsPolicy {
+	if c.cors != nil {
+		return c.cors
+	}
+	return app.cors
+}
+
+//newCORS compile the CORS config, the invalid regex origins are ignored
+func newCORS(c *conf.CORSConf) *corsPolicy {
+	v := *c
+	c = conf.CORSDefault(&v)
+	p := &corsPolicy{
+		origins:     map[string]bool{},
+		methods:     map[string]bool{},
+		allowMethod: c.AllowMethods,
+		allowHeader: c.AllowHeaders,
+		expose:      c.ExposeHeaders,
+		maxAge:      c.MaxAge,
+		credentials: c.AllowCredentials == "true",
+	}
+	for _, o := range split(c.AllowOrigin) {
+		o = strings.ToLower(o)
+		if o == "*" {
+			p.anyOrigin = true
+		} else if pos := strings.Index(o, "*"); pos != -1 {
+			p.wildcards = append(p.wildcards, [2]string{o[0:pos], o[pos+1:]})
+		} else {
+			p.origins[o] = true
+		}
+	}
+	for _, r := range c.AllowOriginRegex {
+		//the regexp must match the full origin(https://.*\.example\.com don't match https://x.example.com.attacker.net)
+		e, err := regexp.Compile(`^(?:` + r + `)$`)
+		if err != nil {
+			logs.Errors("invalid cors origin regex "+r, err)
+			continue
+		}
+		p.regexps = append(p.regexps, e)
+	}
+	for _, m := range split(c.AllowMethods) {
+		m = strings.ToUpper(m)
+		if m == "*" {
+			p.anyMethod = true
+		}
+		p.methods[m] = true
+	}
+	p.anyHeader = strings.TrimSpace(c.AllowHeaders) == "*"
+	return p
+}
+
+//split split the list by ',' and trim the space of items
+func split(list string) []string {
+	vs := []string{}
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			vs = append(vs, v)
+		}
+	}
+	return vs
+}
+
+//allowOrigin return the origin is allowed
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.anyOrigin {
+		return true
+	}
+	o := strings.ToLower(origin)
+	if p.origins[o] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if len(o) > len(w[0])+len(w[1]) && strings.HasPrefix(o, w[0]) && strings.HasSuffix(o, w[1]) {
+			return true
+		}
+	}
+	for _, r := range p.regexps {
+		if r.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+//writeOrigin write the Allow-Origin and Allow-Credentials of origin
+func (p *corsPolicy) writeOrigin(h http.Header, origin string) {
+	if p.anyOrigin && !p.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+//actual write the CORS headers of the actual(non-preflight) request
+func (p *corsPolicy) actual(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	if !p.allowOrigin(origin) {
+		return
+	}
+	p.writeOrigin(h, origin)
+	if p.expose != "" {
+		h.Set("Access-Control-Expose-Headers", p.expose)
+	}
+}
+
+//preflight write the CORS headers of the preflight request
+//the headers are not written when the origin, method or headers are not allowed
+func (p *corsPolicy) preflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	origin := r.Header.Get("Origin")
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if !p.allowOrigin(origin) || (!p.anyMethod && !p.methods[method]) {
+		return
+	}
+	reqHeaders := r.Header.Get("Access-Control-Request-Headers")
+	if p.anyHeader {
+		if reqHeaders != "" {
+			h.Set("Access-Control-Allow-Headers", reqHeaders)
+		}
+	} else {
+		allowed := map[string]bool{}
+		for _, v := range split(p.allowHeader) {
+			allowed[http.CanonicalHeaderKey(v)] = true
+		}
+		for _, v := range split(reqHeaders) {
+			if !allowed[http.CanonicalHeaderKey(v)] {
+				return
+			}
+		}
+		h.Set("Access-Control-Allow-Headers", p.allowHeader)
+	}
+	p.writeOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", p.allowMethod)
+	if p.maxAge != "" {
+		h.Set("Access-Control-Max-Age", p.maxAge)
+	}
+}
+
+//MethodOptionsHandler method Options
+type MethodOptionsHandler struct {
+}
+
+//ServeHTTP method Options handler, the preflight request use the CORS policy of target route
+func (MethodOptionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	method := r.Header.Get("Access-Control-Request-Method")
+	requestLog(w, r).Info("options",
+		logs.String("url", r.RequestURI),
+		logs.String("origin", origin),
+		logs.String("host", r.Host),
+		logs.String("referer", r.Referer()),
+	)
+	if origin != "" && method != "" {
+		if handle, ps, _ := app.preflight.Lookup(method, r.URL.Path); handle != nil {
+			handle(w, r, ps)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//preflightHandle register the preflight handle of pattern
+func preflightHandle(pattern *Pattern) {
+	app.preflight.Handle(pattern.Method, pattern.Pattern, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		pattern.corsPolicy().preflight(w, r)
+	})
+}
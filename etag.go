@@ -0,0 +1,136 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ETag enable the weak ETag(hash of the response body) of api
+//the ETag is output by JSON/XML/YAML(Data,Page etc.) and 304 is output when If-None-Match is matched
+func (c *Pattern) ETag() *Pattern {
+	c.etag = 1
+	return c
+}
+
+//NoETag disable the weak ETag of api(default is 'etag' of app config)
+func (c *Pattern) NoETag() *Pattern {
+	c.etag = -1
+	return c
+}
+
+//weakETag return the weak ETag is enabled of pattern
+func (c *Pattern) weakETag() bool {
+	if c.etag != 0 {
+		return c.etag > 0
+	}
+	return app.etag
+}
+
+//ETag set the ETag of the next output(JSON/XML/YAML,Data,Page etc.) by version
+//it's used instead of the weak hash of response body
+func (c *Context) ETag(version string) {
+	c.etag = quoteETag(version)
+}
+
+//CheckPrecondition check the If-Match and If-Unmodified-Since of request(PUT/PATCH/DELETE etc.)
+//by the current version and last modified time of resource, for optimistic concurrency control.
+//return false and output a SerMustFailed error with 412 status when the precondition is failed
+//	version is the current version of resource, empty is not exist
+//	modified is the last modified time of resource(optional)
+func (c *Context) CheckPrecondition(version string, modified ...time.Time) bool {
+	if preconditionOK(c.In, quoteETag(version), modified...) {
+		return true
+	}
+	c.Status(http.StatusPreconditionFailed)
+	c.FailResult(http.StatusText(http.StatusPreconditionFailed), SerMustFailed)
+	return false
+}
+
+//preconditionOK evaluate If-Match(or If-Unmodified-Since without If-Match) of r
+func preconditionOK(r *http.Request, etag string, modified ...time.Time) bool {
+	if im := r.Header.Get("If-Match"); im != "" {
+		if etag == "" {
+			return false
+		}
+		return matchETag(im, etag, false)
+	}
+	ius := r.Header.Get("If-Unmodified-Since")
+	if ius == "" || len(modified) == 0 || modified[0].IsZero() {
+		return true
+	}
+	t, err := http.ParseTime(ius)
+	if err != nil {
+		return true
+	}
+	return !modified[0].Truncate(time.Second).After(t)
+}
+
+//notModified set the ETag header of response(by version or weak hash of data)
+//and write 304 when the If-None-Match of GET/HEAD request is matched
+func (c *Context) notModified(data []byte) bool {
+	if c.status != 0 && c.status != http.StatusOK {
+		return false
+	}
+	r := c.In
+	if r == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	etag := c.etag
+	if etag == "" {
+		if c.Router == nil || !c.Router.weakETag() {
+			return false
+		}
+		h := fnv.New64a()
+		h.Write(data)
+		etag = `W/"` + strconv.FormatUint(h.Sum64(), 36) + strconv.Itoa(len(data)) + `"`
+	}
+	c.Out.Header().Set("ETag", etag)
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" || !matchETag(inm, etag, true) {
+		return false
+	}
+	h := c.Out.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	c.status = 0
+	c.Out.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+//quoteETag return the quoted(strong) ETag of version
+func quoteETag(version string) string {
+	if version == "" || strings.HasPrefix(version, `W/"`) || (len(version) > 1 && strings.HasPrefix(version, `"`) && strings.HasSuffix(version, `"`)) {
+		return version
+	}
+	return `"` + version + `"`
+}
+
+//matchETag return the etag is matched by the list of If-Match or If-None-Match
+//weak is the weak comparison(If-None-Match), otherwise the strong comparison(If-Match)
+func matchETag(list, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if weak {
+			v = strings.TrimPrefix(v, "W/")
+		} else if strings.HasPrefix(v, "W/") {
+			continue
+		}
+		if v == etag {
+			return true
+		}
+	}
+	return false
+}
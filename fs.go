@@ -12,7 +12,6 @@ import (
 	"strings"
 
 	"github.com/axfor/bast/guid"
-	"github.com/axfor/bast/logs"
 )
 
 //Fs struct
@@ -64,7 +63,7 @@ func FileUpload(ctx *Context, dir, access string) {
 func doFileUpload(ctx *Context, dir, access string, returnRealFile bool) ([]Fs, error) {
 	err := ctx.ParseMultipartForm(32 << 40) //maximum 64M
 	if err != nil {
-		logs.Errors("parseMultipartForm error", err)
+		ctx.Log().Errors("parseMultipartForm error", err)
 		return nil, errors.New("invalid file format")
 	}
 	mp := ctx.In.MultipartForm
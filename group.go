@@ -0,0 +1,182 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"net/http"
+	"time"
+)
+
+//RouterGroup is a set of routes with shared prefix, authorization, registry,
+//parameter and middleware
+//note: group settings apply to routes and groups registered after them
+type RouterGroup struct {
+	prefix        string
+	parameter     interface{}
+	service       string
+	middleware    []Middleware
+	schemes       []string
+	allSchemes    bool
+	roles         []string
+	permissions   []string
+	limiters      []*limiter
+	timeout       time.Duration
+	cors          *corsPolicy
+	authorization bool
+	publish       bool
+}
+
+//Group create a route group with prefix and middleware
+func Group(prefix string, mw ...Middleware) *RouterGroup {
+	return &RouterGroup{prefix: cleanPrefix(prefix), middleware: append([]Middleware{}, mw...)}
+}
+
+//Group create a route group with prefix and middleware
+func (g *RouterGroup) Group(prefix string, mw ...Middleware) *RouterGroup {
+	c := &RouterGroup{
+		prefix:        g.prefix + cleanPrefix(prefix),
+		parameter:     g.parameter,
+		service:       g.service,
+		schemes:       g.schemes,
+		allSchemes:    g.allSchemes,
+		roles:         g.roles,
+		permissions:   g.permissions,
+		limiters:      append([]*limiter{}, g.limiters...),
+		timeout:       g.timeout,
+		cors:          g.cors,
+		authorization: g.authorization,
+		publish:       g.publish,
+	}
+	c.middleware = append(append(c.middleware, g.middleware...), mw...)
+	return c
+}
+
+//Prefix return the group prefix
+func (g *RouterGroup) Prefix() string {
+	return g.prefix
+}
+
+//Auth need api authorization of group routes
+//schemes is the authorization schemes(see AuthScheme),any-of them must pass
+func (g *RouterGroup) Auth(schemes ...string) *RouterGroup {
+	g.authorization = true
+	g.schemes = schemes
+	g.allSchemes = false
+	return g
+}
+
+//AuthAll need api authorization of group routes
+//schemes is the authorization schemes(see AuthScheme),all-of them must pass
+func (g *RouterGroup) AuthAll(schemes ...string) *RouterGroup {
+	g.authorization = true
+	g.schemes = schemes
+	g.allSchemes = true
+	return g
+}
+
+//Unauth need api Unauthorization of group routes
+func (g *RouterGroup) Unauth() *RouterGroup {
+	g.authorization = false
+	g.schemes = nil
+	g.allSchemes = false
+	return g
+}
+
+//Registry register group routes to etcd etc.
+func (g *RouterGroup) Registry(service string) *RouterGroup {
+	g.publish = true
+	g.service = service
+	return g
+}
+
+//Unregistry unregister group routes to etcd etc.
+func (g *RouterGroup) Unregistry() *RouterGroup {
+	g.publish = false
+	g.service = ""
+	return g
+}
+
+//Param set default router parameter of group routes
+func (g *RouterGroup) Param(Parameter interface{}) *RouterGroup {
+	g.parameter = Parameter
+	return g
+}
+
+//Use append middleware to group routes
+func (g *RouterGroup) Use(mw ...Middleware) *RouterGroup {
+	g.middleware = append(g.middleware, mw...)
+	return g
+}
+
+//All registers the handler function for the given pattern of all method
+func (g *RouterGroup) All(pattern string, f func(ctx *Context)) {
+	for _, m := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch, http.MethodHead, http.MethodOptions} {
+		g.handle(m, pattern, f)
+	}
+}
+
+//Get registers the handler function for the given pattern of group
+func (g *RouterGroup) Get(pattern string, f func(ctx *Context)) *Pattern {
+	return g.handle(http.MethodGet, pattern, f)
+}
+
+//Post registers the handler function for the given pattern of group
+func (g *RouterGroup) Post(pattern string, f func(ctx *Context)) *Pattern {
+	return g.handle(http.MethodPost, pattern, f)
+}
+
+//Put registers the handler function for the given pattern of group
+func (g *RouterGroup) Put(pattern string, f func(ctx *Context)) *Pattern {
+	return g.handle(http.MethodPut, pattern, f)
+}
+
+//Delete registers the handler function for the given pattern of group
+func (g *RouterGroup) Delete(pattern string, f func(ctx *Context)) *Pattern {
+	return g.handle(http.MethodDelete, pattern, f)
+}
+
+//Head registers the handler function for the given pattern of group
+func (g *RouterGroup) Head(pattern string, f func(ctx *Context)) *Pattern {
+	return g.handle(http.MethodHead, pattern, f)
+}
+
+//Patch registers the handler function for the given pattern of group
+func (g *RouterGroup) Patch(pattern string, f func(ctx *Context)) *Pattern {
+	return g.handle(http.MethodPatch, pattern, f)
+}
+
+//Options registers the handler function for the given pattern of group
+func (g *RouterGroup) Options(pattern string, f func(ctx *Context)) *Pattern {
+	return g.handle(http.MethodOptions, pattern, f)
+}
+
+func (g *RouterGroup) handle(method, pattern string, fn func(ctx *Context)) *Pattern {
+	if pattern == "/" && g.prefix != "" {
+		pattern = ""
+	}
+	r := routerHandle(method, g.prefix+pattern, fn)
+	r.Parameter = g.parameter
+	r.authorization = g.authorization
+	r.schemes = g.schemes
+	r.allSchemes = g.allSchemes
+	r.roles = g.roles
+	r.permissions = g.permissions
+	r.limiters = append(r.limiters, g.limiters...)
+	r.timeout = g.timeout
+	r.cors = g.cors
+	r.publish = g.publish
+	r.Service = g.service
+	r.middleware = append(r.middleware, g.middleware...)
+	return r
+}
+
+//cleanPrefix make sure prefix begin with '/' and without trailing '/'
+func cleanPrefix(prefix string) string {
+	for len(prefix) > 0 && prefix[len(prefix)-1] == '/' {
+		prefix = prefix[:len(prefix)-1]
+	}
+	if prefix != "" && prefix[0] != '/' {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
@@ -0,0 +1,212 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/logs"
+)
+
+//listenerEnv is the fd of listener which is passed by master(see ExtraFiles of exec.Cmd)
+const listenerEnv = "BAST_LISTENER_FD"
+
+//debugListenerEnv is the fd of admin listener(see DebugConf.Addr) which is passed by master to the first work process
+const debugListenerEnv = "BAST_DEBUG_FD"
+
+//readyTimeout is the max time of new work process to be ready in reload
+const readyTimeout = 60 * time.Second
+
+//listenFile return the listening socket file of app, it's owned by master and passed to work processes
+//the listener of systemd socket activation is used when it's passed
+func listenFile(c *conf.AppConf) *os.File {
+	if !handoff() || c.Addr == "" {
+		return nil
+	}
+	return masterListenFile(c.Key, c.Addr, socketMode(c))
+}
+
+//debugListenFile return the admin listening socket file of app, it's owned by master and passed to the first work process
+//so the admin address is kept in reload
+func debugListenFile(c *conf.AppConf) *os.File {
+	d := c.DebugRouter
+	if !handoff() || d == nil || !d.Enable || d.Addr == "" {
+		return nil
+	}
+	return masterListenFile(c.Key+"#debug", d.Addr, 0)
+}
+
+//masterListenFile return the listening socket file of address which is cached by key in master
+func masterListenFile(key, addr string, mode os.FileMode) *os.File {
+	if f, ok := app.listeners[key]; ok {
+		return f
+	}
+	l := activatedListener(addr)
+	if l == nil {
+		var err error
+		if l, err = listen(addr, mode); err != nil {
+			logs.Errors("master listen failed, the work process listen by itself", err)
+			return nil
+		}
+	}
+	//the socket file is used by work processes
+	if ul, ok := l.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	f, err := listenerFile(l.(fileListener))
+	l.Close()
+	if err != nil {
+		logs.Errors("master listener file failed", err)
+		return nil
+	}
+	app.listeners[key] = f
+	return f
+}
+
+//workCommand return the command of the index work process of app, the listener of app is passed when it's supported
+//(the work processes listen by themselves with SO_REUSEPORT, see useReusePort)
+//and the admin listener is passed to the first work process
+func workCommand(c *conf.AppConf, index int) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "--daemon", "--appkey="+c.Key, "--pipe="+app.pipeName, "--conf="+conf.Path())
+	cmd.Dir = AppDir()
+	cmd.Env = append(os.Environ(), workerIndexEnv+"="+strconv.Itoa(index))
+	pass := func(env string, f *os.File) {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+		cmd.Env = append(cmd.Env, env+"="+strconv.Itoa(2+len(cmd.ExtraFiles)))
+	}
+	if !useReusePort(c) {
+		if f := listenFile(c); f != nil {
+			pass(listenerEnv, f)
+		}
+	}
+	if index == 0 {
+		if f := debugListenFile(c); f != nil {
+			pass(debugListenerEnv, f)
+		}
+	}
+	return cmd
+}
+
+//inheritedListener return the listener of address which is passed by master, nil is not passed
+func inheritedListener(addr string) (net.Listener, error) {
+	return inheritedListenerOf(listenerEnv, addr)
+}
+
+//inheritedListenerOf return the listener of address which fd is the env, nil is not passed
+func inheritedListenerOf(env, addr string) (net.Listener, error) {
+	v := os.Getenv(env)
+	if v == "" {
+		return nil, nil
+	}
+	os.Unsetenv(env)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	//the address of run is not the address of app conf
+	if !sameAddr(l.Addr(), addr) {
+		logs.Info("the listener of master is not used", logs.String("address", addr), logs.String("listener", l.Addr().String()))
+		l.Close()
+		return nil, nil
+	}
+	return l, nil
+}
+
+//reloading is the new work processes of reload, key is pid
+type reloading map[int]*pending
+
+//pending is a new work process which is waiting to be ready
+type pending struct {
+	index int
+	cmd   *exec.Cmd
+	timer *time.Timer
+}
+
+//reloadWorks start a new work process for each running work, the old one is stopped after the new one is ready
+//wait is called for each new process, and expired is sent the pid when it's not ready in time
+func reloadWorks(rs reloading, wait func(cmd *exec.Cmd), expired chan int) {
+	for i := range app.cmd {
+		w := &app.cmd[i]
+		c := conf.WithKey(w.key)
+		if !w.runing || c == nil {
+			continue
+		}
+		cmd := workCommand(c, w.index)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			logs.Errors("reload work process failed", err)
+			continue
+		}
+		pid := cmd.Process.Pid
+		logs.Info("reload work process", logs.String("key", w.key), logs.Int("worker", w.index), logs.Int("pid", pid))
+		rs[pid] = &pending{index: i, cmd: cmd, timer: time.AfterFunc(readyTimeout, func() {
+			expired <- pid
+		})}
+		wait(cmd)
+	}
+}
+
+//ready replace the old work process with the ready one and stop the old one gracefully
+func (rs reloading) ready(pid int) {
+	p, ok := rs[pid]
+	if !ok {
+		return
+	}
+	delete(rs, pid)
+	p.timer.Stop()
+	w := &app.cmd[p.index]
+	old := w.cmd
+	*w = work{key: w.key, index: w.index, cmd: p.cmd, runing: true, exitCount: w.exitCount, crashes: w.crashes}
+	logPid()
+	if old != nil && old.Process != nil {
+		logs.Info("stop old work process", logs.String("key", w.key), logs.Int("pid", old.Process.Pid))
+		go stopWork(old.Process.Pid)
+	}
+}
+
+//abort kill the new work process which is not ready, the old one keep serving
+func (rs reloading) abort(pid int, reason string) bool {
+	p, ok := rs[pid]
+	if !ok {
+		return false
+	}
+	delete(rs, pid)
+	p.timer.Stop()
+	logs.Error("reload work process aborted", logs.Int("pid", pid), logs.String("reason", reason))
+	p.cmd.Process.Kill()
+	return true
+}
+
+//reloadMaster tell the running master to reload work processes(by control pipe or SIGHUP)
+//false is the master is not running
+func reloadMaster() (bool, error) {
+	if !handoff() {
+		return false, nil
+	}
+	pid := getMasterPidWithFile()
+	if pid <= 0 || pid == os.Getpid() {
+		return false, nil
+	}
+	err := callMaster(cmdReload, nil, nil)
+	if err == nil {
+		return true, nil
+	}
+	logs.Errors("reload master by pipe failed", err)
+	if err := sendSignal(syscall.SIGHUP, pid); err != nil {
+		return false, err
+	}
+	return true, nil
+}
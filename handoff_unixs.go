@@ -0,0 +1,32 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// +build !windows
+
+package bast
+
+import (
+	"os"
+	"syscall"
+)
+
+//handoff is supported when the master can pass the listener to work process
+func handoff() bool {
+	return true
+}
+
+//listenerFile return the blocking file of listener, it's passed to work processes by exec
+//the work processes share the file description, os.File.Fd of a non-blocking file switch it to blocking
+//mode and the accepting of running work processes is blocked, so the file is created in blocking mode
+func listenerFile(l fileListener) (*os.File, error) {
+	f, err := l.File()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	syscall.CloseOnExec(fd)
+	return os.NewFile(uintptr(fd), f.Name()), nil
+}
@@ -0,0 +1,20 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// +build windows
+
+package bast
+
+import (
+	"errors"
+	"os"
+)
+
+//handoff is not supported, the work processes listen by themselves
+func handoff() bool {
+	return false
+}
+
+//listenerFile is not supported
+func listenerFile(l fileListener) (*os.File, error) {
+	return nil, errors.New("listener handoff is not supported on windows")
+}
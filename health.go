@@ -0,0 +1,209 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/session"
+)
+
+//HealthCheck check a subsystem of app, nil is healthy
+type HealthCheck func(ctx context.Context) error
+
+//HealthChecker is the health of app, the liveness checks are served by liveness path(default /healthz)
+//and all checks are served by readiness path(default /readyz)
+type HealthChecker struct {
+	lock     sync.RWMutex
+	live     map[string]HealthCheck
+	ready    map[string]HealthCheck
+	draining int32
+	timeout  time.Duration
+}
+
+//HealthResult is the result of health checks
+type HealthResult struct {
+	Status string                  `json:"status"` //ok|fail|draining
+	Checks map[string]*CheckResult `json:"checks,omitempty"`
+}
+
+//CheckResult is the result of a health check
+type CheckResult struct {
+	Status string `json:"status"` //ok|fail
+	Error  string `json:"error,omitempty"`
+	Cost   string `json:"cost"`
+}
+
+var health = newHealth()
+
+//newHealth create the health with built-in checks of session, registry and discovery
+func newHealth() *HealthChecker {
+	h := &HealthChecker{live: map[string]HealthCheck{}, ready: map[string]HealthCheck{}, timeout: 3 * time.Second}
+	h.Ready("session", func(ctx context.Context) error {
+		return session.Ping()
+	})
+	h.Ready("registry", func(ctx context.Context) error {
+		//the lease is kept alive after the routes are published(see Registry)
+		if app.registry != nil && app.registry.Registered() && !app.registry.Alive() {
+			return errors.New("registry lease is not kept alive")
+		}
+		return nil
+	})
+	h.Ready("discovery", func(ctx context.Context) error {
+		if app.discovery != nil && !app.discovery.Watching() {
+			return errors.New("discovery is not watching")
+		}
+		return nil
+	})
+	return h
+}
+
+//Health return the health of app
+func Health() *HealthChecker {
+	return health
+}
+
+//Live register a liveness check(the app should be restarted when it's failed)
+//liveness checks are readiness checks too
+func (h *HealthChecker) Live(name string, f HealthCheck) *HealthChecker {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.live[name] = f
+	return h
+}
+
+//Ready register a readiness check(the app should not receive traffic when it's failed)
+func (h *HealthChecker) Ready(name string, f HealthCheck) *HealthChecker {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.ready[name] = f
+	return h
+}
+
+//Draining return the app is draining(see Shutdown), it's not ready when it's true
+func (h *HealthChecker) Draining() bool {
+	return atomic.LoadInt32(&h.draining) == 1
+}
+
+//drain flip the readiness to not-ready
+func (h *HealthChecker) drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+//Liveness run the liveness checks
+func (h *HealthChecker) Liveness(ctx context.Context) *HealthResult {
+	return h.run(ctx, false)
+}
+
+//Readiness run the liveness and readiness checks, it's draining when the app is shutting down
+func (h *HealthChecker) Readiness(ctx context.Context) *HealthResult {
+	if h.Draining() {
+		return &HealthResult{Status: "draining"}
+	}
+	return h.run(ctx, true)
+}
+
+//run run the checks concurrently with timeout
+func (h *HealthChecker) run(ctx context.Context, ready bool) *HealthResult {
+	h.lock.RLock()
+	checks := make(map[string]HealthCheck, len(h.live)+len(h.ready))
+	for k, f := range h.live {
+		checks[k] = f
+	}
+	if ready {
+		for k, f := range h.ready {
+			checks[k] = f
+		}
+	}
+	h.lock.RUnlock()
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	names := make([]string, 0, len(checks))
+	for k := range checks {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	results := make([]*CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, f HealthCheck) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, f)
+		}(i, checks[name])
+	}
+	wg.Wait()
+	r := &HealthResult{Status: "ok", Checks: make(map[string]*CheckResult, len(names))}
+	for i, name := range names {
+		r.Checks[name] = results[i]
+		if results[i].Status != "ok" {
+			r.Status = "fail"
+		}
+	}
+	return r
+}
+
+//runCheck run a check, it's failed when it's panicked or timeout
+func runCheck(ctx context.Context, f HealthCheck) *CheckResult {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- errors.New("health check panic")
+			}
+		}()
+		done <- f(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	r := &CheckResult{Status: "ok", Cost: time.Since(start).String()}
+	if err != nil {
+		r.Status = "fail"
+		r.Error = err.Error()
+	}
+	return r
+}
+
+//healthRouter register the liveness and readiness routes when it's enabled
+//the probes are exempt from the app-level middleware, rate limit, timeout, before/after and authorization,
+//so a busy or locked app is not killed or pulled out of rotation by its probes
+func healthRouter(c *conf.HealthConf) {
+	if !c.Enable {
+		return
+	}
+	if c.Timeout > 0 {
+		health.timeout = time.Duration(c.Timeout) * time.Millisecond
+	}
+	route := func(path string, run func(ctx context.Context) *HealthResult) {
+		if path == "" {
+			return
+		}
+		if _, ok := app.pattern[http.MethodGet+path]; ok {
+			return
+		}
+		p := Get(path, func(ctx *Context) {
+			r := run(ctx.Context())
+			ctx.Out.Header().Set("Cache-Control", "no-store")
+			if r.Status != "ok" {
+				ctx.Status(http.StatusServiceUnavailable)
+			}
+			ctx.JSONResult(r)
+		}).Unauth()
+		p.hidden = true
+		p.probe = true
+	}
+	route(c.Liveness, health.Liveness)
+	route(c.Readiness, health.Readiness)
+}
@@ -5,6 +5,7 @@ package httpc
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
@@ -18,10 +19,12 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/axfor/bast/logs"
+	"github.com/axfor/bast/metrics"
 	"github.com/axfor/bast/service"
 	"gopkg.in/yaml.v2"
 )
@@ -40,6 +43,25 @@ var (
 	defaultDiscovery *service.Discovery
 )
 
+//RequestIDHeader is the header of request id
+const RequestIDHeader = "X-Request-ID"
+
+//unknownService is the service label of metrics without service name
+const unknownService = "unknown"
+
+type requestIDKey struct{}
+
+//WithRequestID return a copy of ctx with request id, it's forwarded by Client.Context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+//RequestID return the request id of ctx(see WithRequestID)
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
 //Client http client
 type Client struct {
 	Req       *http.Request
@@ -52,6 +74,8 @@ type Client struct {
 	err       error
 	body      []byte
 	bodyClose bool
+	service   string //service name of metrics
+	hostLabel bool   //label metrics with host of url when there's no service name
 }
 
 //Settings of Client
@@ -87,6 +111,31 @@ func (c *Client) Request(request *http.Request) *Client {
 	return c
 }
 
+// Context set the context of request, the request is canceled when it's done
+// and the request id of ctx is forwarded(see WithRequestID)
+func (c *Client) Context(ctx context.Context) *Client {
+	if ctx != nil {
+		c.Req = c.Req.WithContext(ctx)
+		if id := RequestID(ctx); id != "" {
+			c.Header(RequestIDHeader, id)
+		}
+	}
+	return c
+}
+
+// Metric set the service label of metrics(default is the service name, or unknown)
+func (c *Client) Metric(service string) *Client {
+	c.service = service
+	return c
+}
+
+// HostLabel label the metrics with host of url when there's no service name
+// note: the hosts must be bounded, such as the fixed hosts of config
+func (c *Client) HostLabel() *Client {
+	c.hostLabel = true
+	return c
+}
+
 // Title set title
 func (c *Client) Title(title string) *Client {
 	c.Conf.Title = title
@@ -628,7 +677,14 @@ func Service(serviceName, method string) *Client {
 	if serviceName != "" && defaultDiscovery != nil {
 		uri = defaultDiscovery.Name(serviceName)
 	}
-	return createRequest(uri, method)
+	c := createRequest(uri, method)
+	c.service = serviceName
+	return c
+}
+
+//NewRequest returns *Client with url and http xxx method
+func NewRequest(method, url string) *Client {
+	return createRequest(url, method)
 }
 
 func createRequest(uri, method string) *Client {
@@ -667,8 +723,13 @@ func (c *Client) Do() (resp *http.Response, err error) {
 	if c.Conf.Title != "" {
 		title = c.Conf.Title
 	}
+	//the request id of ctx is added to the access logs
+	log := logs.With()
+	if id := RequestID(c.Req.Context()); id != "" {
+		log = logs.With(logs.String("requestId", id))
+	}
 	if c.Conf.Log {
-		logs.Info(title,
+		log.Info(title,
 			logs.String("module", "httpc"),
 			logs.String("stage", "start"),
 			logs.String("url", c.Req.URL.String()),
@@ -681,11 +742,12 @@ func (c *Client) Do() (resp *http.Response, err error) {
 	rc := 0
 	for ; c.Conf.Retry == -1 || rc <= c.Conf.Retry; rc++ {
 		resp, err = c.client.Do(c.Req)
-		if err == nil {
+		if err == nil || c.Req.Context().Err() != nil {
 			break
 		}
 	}
 	c.resp = resp
+	c.observe(st)
 	callAfter(c)
 	if c.Conf.Log {
 		statusCode := 0
@@ -694,7 +756,7 @@ func (c *Client) Do() (resp *http.Response, err error) {
 			statusCode = c.resp.StatusCode
 			statusText = c.resp.Status
 		}
-		logs.Info(title,
+		log.Info(title,
 			logs.String("module", "httpc"),
 			logs.String("stage", "finish"),
 			logs.String("url", c.Req.URL.String()),
@@ -709,6 +771,23 @@ func (c *Client) Do() (resp *http.Response, err error) {
 	return
 }
 
+//observe record the metrics of request, the service is unknown without service name(see Metric and HostLabel)
+func (c *Client) observe(start time.Time) {
+	service := c.service
+	if service == "" {
+		service = unknownService
+		if c.hostLabel && c.Req.URL != nil && c.Req.URL.Host != "" {
+			service = c.Req.URL.Host
+		}
+	}
+	code := 0
+	if c.resp != nil {
+		code = c.resp.StatusCode
+	}
+	metrics.ClientDuration.WithLabelValues(service, c.Req.Method).Observe(time.Since(start).Seconds())
+	metrics.ClientRequests.WithLabelValues(service, c.Req.Method, strconv.Itoa(code)).Inc()
+}
+
 func (c *Client) build() error {
 	if c.Conf.EnableCookie && c.client.Jar == nil {
 		c.client.Jar = DefaultCookieJar
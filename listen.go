@@ -0,0 +1,144 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/logs"
+)
+
+//unixPrefix is the prefix of unix socket address(such as: unix:/run/app.sock)
+const unixPrefix = "unix:"
+
+//the environments of systemd socket activation(see sd_listen_fds)
+const (
+	listenPidEnv   = "LISTEN_PID"
+	listenFdsEnv   = "LISTEN_FDS"
+	listenNamesEnv = "LISTEN_FDNAMES"
+	listenFdsStart = 3
+)
+
+//activated is the listeners which are passed by systemd
+var activated struct {
+	once      sync.Once
+	listeners []net.Listener
+}
+
+//fileListener is a listener which has the socket file(tcp or unix)
+type fileListener interface {
+	net.Listener
+	File() (*os.File, error)
+}
+
+//splitAddr return the network and address of addr, the network is unix when it's prefixed with unix:
+func splitAddr(addr string) (string, string) {
+	if strings.HasPrefix(addr, unixPrefix) {
+		return "unix", strings.TrimPrefix(addr, unixPrefix)
+	}
+	return "tcp", addr
+}
+
+//isUnix return the addr is a unix socket address
+func isUnix(addr string) bool {
+	network, _ := splitAddr(addr)
+	return network == "unix"
+}
+
+//socketMode return the file mode of unix socket of app conf, 0 is not changed
+func socketMode(c *conf.AppConf) os.FileMode {
+	if c == nil || c.SocketMode == "" {
+		return 0
+	}
+	m, err := strconv.ParseUint(c.SocketMode, 8, 32)
+	if err != nil {
+		logs.Errors("invalid socket mode "+c.SocketMode, err)
+		return 0
+	}
+	return os.FileMode(m)
+}
+
+//listen listen the tcp or unix socket address, the stale socket file is removed
+//and the file mode of unix socket is changed when mode is not 0
+func listen(addr string, mode os.FileMode) (net.Listener, error) {
+	network, address := splitAddr(addr)
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+	removeStaleSocket(address)
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(address, mode); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+//removeStaleSocket remove the socket file which is not listened(the process is exited without removing it)
+func removeStaleSocket(path string) {
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return
+	}
+	os.Remove(path)
+}
+
+//activatedListener return the listener of address which is passed by systemd socket activation, nil is not passed
+func activatedListener(addr string) net.Listener {
+	activated.once.Do(func() {
+		activated.listeners = activationListeners(listenFdsStart)
+	})
+	for i, l := range activated.listeners {
+		if l != nil && sameAddr(l.Addr(), addr) {
+			activated.listeners[i] = nil
+			return l
+		}
+	}
+	return nil
+}
+
+//activationListeners return the listeners of LISTEN_FDS(from the fd of start) when LISTEN_PID is the pid of process
+//the environments are unset, so the child processes don't use them
+func activationListeners(start int) []net.Listener {
+	pid, _ := strconv.Atoi(os.Getenv(listenPidEnv))
+	n, _ := strconv.Atoi(os.Getenv(listenFdsEnv))
+	names := strings.Split(os.Getenv(listenNamesEnv), ":")
+	os.Unsetenv(listenPidEnv)
+	os.Unsetenv(listenFdsEnv)
+	os.Unsetenv(listenNamesEnv)
+	if runtime.GOOS == "windows" || pid != os.Getpid() || n <= 0 {
+		return nil
+	}
+	ls := []net.Listener{}
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(start+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(start+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			logs.Errors("systemd listener "+name, err)
+			continue
+		}
+		logs.Info("systemd listener", logs.String("name", name), logs.String("address", l.Addr().String()))
+		ls = append(ls, l)
+	}
+	return ls
+}
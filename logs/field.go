@@ -161,6 +161,12 @@ func String(key string, val string) zap.Field {
 
 }
 
+// Strings constructs a field that carries a slice of strings.
+func Strings(key string, val []string) zap.Field {
+	return zap.Strings(key, val)
+
+}
+
 // Stringp constructs a field that carries a *string. The returned Field will safely
 // and explicitly represent `nil` when appropriate.
 func Stringp(key string, val *string) zap.Field {
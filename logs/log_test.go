@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+
+	"go.uber.org/zap/zapcore"
 )
 
 func Test_Info(t *testing.T) {
@@ -20,6 +22,19 @@ func Test_Info(t *testing.T) {
 	}
 }
 
+func Test_SetLevel(t *testing.T) {
+	defer SetLevel("info")
+	if err := SetLevel("warn"); err != nil || Level() != "warn" {
+		t.Fatal(Level(), err)
+	}
+	if logger.Core().Enabled(zapcore.InfoLevel) {
+		t.Error("info is enabled")
+	}
+	if err := SetLevel("verbose"); err == nil || Level() != "warn" {
+		t.Fatal(Level(), err)
+	}
+}
+
 func init() {
 	Init(nil)
 }
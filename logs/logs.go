@@ -22,6 +22,7 @@ import (
 
 var (
 	logger                       *Log
+	level                        = zap.NewAtomicLevel()
 	gromDebugLogger              = log.New(os.Stdout, "\r\n", 0)
 	gromSQLRegexp                = regexp.MustCompile(`\?`)
 	gromNumericPlaceHolderRegexp = regexp.MustCompile(`\$\d+`)
@@ -82,7 +83,7 @@ func newLog(conf *Conf) *Log {
 		conf.MaxAge = 28
 	}
 
-	l := logLevel(conf.Level)
+	level.SetLevel(logLevel(conf.Level))
 	var w zapcore.WriteSyncer
 	var core zapcore.Core
 	if !conf.Stdout {
@@ -100,7 +101,7 @@ func newLog(conf *Conf) *Log {
 		core = zapcore.NewCore(
 			zapcore.NewJSONEncoder(encoderConfig),
 			w,
-			l,
+			level,
 		)
 	} else {
 		encoderConfig := zap.NewDevelopmentEncoderConfig()
@@ -111,6 +112,8 @@ func newLog(conf *Conf) *Log {
 
 		//jsonDebugging := zapcore.AddSync(ioutil.Discard)
 		//jsonErrors := zapcore.AddSync(ioutil.Discard)
+		//the stdout logs all levels by default
+		level.SetLevel(zapcore.DebugLevel)
 		consoleDebugging := zapcore.Lock(os.Stdout)
 		consoleErrors := zapcore.Lock(os.Stderr)
 
@@ -121,7 +124,7 @@ func newLog(conf *Conf) *Log {
 			//zapcore.NewCore(jsonEncoder, jsonErrors, highPriority),
 			zapcore.NewCore(consoleEncoder, consoleErrors, zapcore.FatalLevel),
 			//zapcore.NewCore(jsonEncoder, jsonDebugging, lowPriority),
-			zapcore.NewCore(consoleEncoder, consoleDebugging, zapcore.DebugLevel),
+			zapcore.NewCore(consoleEncoder, consoleDebugging, level),
 		)
 
 		// w, _, _ = zap.Open("stdout")
@@ -322,6 +325,20 @@ func Sync() {
 	}
 }
 
+//With creates a child logger and adds structured context to it
+func (l *Log) With(fields ...zap.Field) *Log {
+	return &Log{Logger: *l.Logger.With(fields...), logConf: l.logConf}
+}
+
+//With creates a child logger of default logger and adds structured context to it
+//it's a no-op logger when the default logger is not initialized
+func With(fields ...zap.Field) *Log {
+	if logger == nil {
+		return &Log{Logger: *zap.NewNop()}
+	}
+	return logger.With(fields...)
+}
+
 //Default rew logger object
 func Default() *Log {
 	return logger
@@ -561,6 +578,21 @@ func isPrintable(s string) bool {
 	return true
 }
 
+//SetLevel change the level of logs at runtime(debug|info|warn|error|dpanic|panic|fatal)
+func SetLevel(text string) error {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(text)); err != nil {
+		return err
+	}
+	level.SetLevel(l)
+	return nil
+}
+
+//Level return the current level of logs
+func Level() string {
+	return level.Level().String()
+}
+
 func logLevel(text string) zapcore.Level {
 	text = strings.ToLower(text)
 	switch text {
@@ -0,0 +1,104 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/logs"
+	"github.com/axfor/bast/metrics"
+)
+
+//workerRestartsEnv is the restart count of work process which is passed by master
+const workerRestartsEnv = "BAST_WORKER_RESTARTS"
+
+//metricsRouter register the metrics route(prometheus text format) when it's enabled
+func metricsRouter(c *conf.MetricsConf) {
+	if !c.Enable {
+		return
+	}
+	if n, err := strconv.ParseFloat(os.Getenv(workerRestartsEnv), 64); err == nil && n > 0 {
+		metrics.WorkerRestarts.WithLabelValues(flagAppKey).Add(n)
+	}
+	if _, ok := app.pattern[http.MethodGet+c.Path]; ok {
+		return
+	}
+	h := metrics.Handler()
+	p := Get(c.Path, func(ctx *Context) {
+		h.ServeHTTP(ctx.Out, ctx.In)
+	}).Uncompress()
+	p.hidden = true
+	if len(c.Auth) > 0 {
+		p.Auth(c.Auth...)
+	}
+	logs.Info("metrics is enabled", logs.String("path", c.Path))
+}
+
+//observe record the request metrics of pattern, call the returned func when it's finished
+func observe(pattern *Pattern, w *metricWriter) func() {
+	m, p, n := pattern.Method, pattern.Pattern, pattern.Name
+	inFlight := metrics.InFlight.WithLabelValues(m, p, n)
+	inFlight.Inc()
+	start := time.Now()
+	return func() {
+		inFlight.Dec()
+		metrics.Duration.WithLabelValues(m, p, n).Observe(time.Since(start).Seconds())
+		code := w.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+		metrics.Requests.WithLabelValues(m, p, n, strconv.Itoa(code)).Inc()
+	}
+}
+
+//metricWriter record the status code of response
+type metricWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (mw *metricWriter) WriteHeader(code int) {
+	if mw.code == 0 {
+		mw.code = code
+	}
+	mw.ResponseWriter.WriteHeader(code)
+}
+
+func (mw *metricWriter) Write(p []byte) (int, error) {
+	if mw.code == 0 {
+		mw.code = http.StatusOK
+	}
+	return mw.ResponseWriter.Write(p)
+}
+
+//Flush sends any buffered data to the client
+func (mw *metricWriter) Flush() {
+	if f, ok := mw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Hijack implements the http.Hijacker interface
+func (mw *metricWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := mw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("not support http hijacker")
+	}
+	mw.code = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+//Push implements the http.Pusher interface
+func (mw *metricWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := mw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
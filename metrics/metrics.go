@@ -0,0 +1,90 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// Package metrics provides the prometheus metrics of http server, http client(httpc),
+//session, service registry and work processes.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+//Registry is the registry of all metrics, the go and process collectors are registered
+var Registry = prometheus.NewRegistry()
+
+//http server metrics, labelled by method, pattern and nickname of route
+var (
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bast_http_requests_total",
+		Help: "Total number of http requests.",
+	}, []string{"method", "pattern", "nickname", "code"})
+	Duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bast_http_request_duration_seconds",
+		Help:    "Latency of http requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "pattern", "nickname"})
+	InFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bast_http_requests_in_flight",
+		Help: "Number of http requests being served.",
+	}, []string{"method", "pattern", "nickname"})
+	Panics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bast_http_panics_total",
+		Help: "Total number of recovered panics of http requests.",
+	}, []string{"method", "pattern", "nickname"})
+)
+
+//http client metrics, labelled by service name(unknown or host of url without it, see httpc.Client.HostLabel)
+var (
+	ClientRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bast_httpc_requests_total",
+		Help: "Total number of http client requests, code is 0 when the request is failed.",
+	}, []string{"service", "method", "code"})
+	ClientDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bast_httpc_request_duration_seconds",
+		Help:    "Latency of http client requests(include retries).",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "method"})
+)
+
+//session metrics, labelled by engine
+var (
+	SessionLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bast_session_lookups_total",
+		Help: "Total number of session lookups, result is hit or miss.",
+	}, []string{"engine", "result"})
+	SessionStoreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bast_session_store_duration_seconds",
+		Help:    "Latency of session store operations, op is load or commit.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"engine", "op"})
+)
+
+//service registry and work process metrics
+var (
+	RegistryKeepAlive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bast_registry_keepalive",
+		Help: "Whether the lease of service registry is kept alive(1 is alive).",
+	}, []string{"prefix"})
+	WorkerRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bast_worker_restarts_total",
+		Help: "Total number of work process restarts by master.",
+	}, []string{"worker"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		Requests, Duration, InFlight, Panics,
+		ClientRequests, ClientDuration,
+		SessionLookups, SessionStoreDuration,
+		RegistryKeepAlive, WorkerRestarts,
+	)
+}
+
+//Handler return the http handler of metrics(prometheus text format)
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
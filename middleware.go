@@ -0,0 +1,39 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+//Handle a request handler
+type Handle func(ctx *Context)
+
+//Middleware wraps the next handle of the chain
+//a middleware may short-circuit the chain by not calling next
+type Middleware func(next Handle) Handle
+
+//Use append app-level middleware to each request
+//note: app-level middleware wraps route-level middleware and
+//must be registered before the app starts
+func Use(mw ...Middleware) {
+	app.middleware = append(app.middleware, mw...)
+}
+
+//Use append route-level middleware to the pattern
+func (c *Pattern) Use(mw ...Middleware) *Pattern {
+	c.middleware = append(c.middleware, mw...)
+	return c
+}
+
+//chain build the middleware chain of the pattern
+//the first registered middleware is the outermost one
+//the health probes skip the app-level middleware
+func (c *Pattern) chain(h Handle) Handle {
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		h = c.middleware[i](h)
+	}
+	if c.probe {
+		return h
+	}
+	for i := len(app.middleware) - 1; i >= 0; i-- {
+		h = app.middleware[i](h)
+	}
+	return h
+}
@@ -0,0 +1,128 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/axfor/bast/logs"
+)
+
+//the environments of systemd notify(see sd_notify and sd_watchdog_enabled)
+const (
+	notifySocketEnv = "NOTIFY_SOCKET"
+	watchdogUsecEnv = "WATCHDOG_USEC"
+	watchdogPidEnv  = "WATCHDOG_PID"
+)
+
+//notifier is the sd_notify client of systemd, it's disabled when NOTIFY_SOCKET is empty
+type notifier struct {
+	addr     string        //address of notify socket(@ is abstract namespace)
+	watchdog time.Duration //interval of watchdog pings(half of WATCHDOG_USEC), 0 is disabled
+}
+
+var systemd = newNotifier()
+
+//newNotifier create the notifier by environments, they are unset so the work processes don't notify systemd
+func newNotifier() *notifier {
+	n := &notifier{addr: os.Getenv(notifySocketEnv)}
+	usec, _ := strconv.ParseInt(os.Getenv(watchdogUsecEnv), 10, 64)
+	pid := os.Getenv(watchdogPidEnv)
+	if usec > 0 && (pid == "" || pid == strconv.Itoa(os.Getpid())) {
+		n.watchdog = time.Duration(usec) * time.Microsecond / 2
+	}
+	os.Unsetenv(notifySocketEnv)
+	os.Unsetenv(watchdogUsecEnv)
+	os.Unsetenv(watchdogPidEnv)
+	return n
+}
+
+//notify send the state(such as: READY=1) to systemd
+func (n *notifier) notify(state string) error {
+	if n.addr == "" {
+		return nil
+	}
+	name := n.addr
+	if strings.HasPrefix(name, "@") {
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		logs.Errors("systemd notify "+state, err)
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		logs.Errors("systemd notify "+state, err)
+	}
+	return err
+}
+
+//reloading notify systemd the app is reloading, READY=1 is sent when it's finished
+func (n *notifier) reloading() error {
+	state := "RELOADING=1"
+	if usec := monotonic(); usec > 0 {
+		state += "\nMONOTONIC_USEC=" + strconv.FormatInt(usec, 10)
+	}
+	return n.notify(state)
+}
+
+//watch ping the watchdog of systemd until the app is stopped, the pings stop when the liveness checks are failed
+func (n *notifier) watch() {
+	if n.addr == "" || n.watchdog <= 0 {
+		return
+	}
+	t := time.NewTicker(n.watchdog)
+	defer t.Stop()
+	for range t.C {
+		if !app.runing {
+			return
+		}
+		if r := health.Liveness(context.Background()); r.Status != "ok" {
+			logs.Error("liveness checks failed, skip watchdog ping")
+			continue
+		}
+		n.notify("WATCHDOG=1")
+	}
+}
+
+//notifyReady notify systemd the master is ready when all work processes are listening(see cmdReady)
+//it's sent again when the reload is finished
+func (m *master) notifyReady() {
+	if m.notified || len(m.reloads) > 0 || len(app.cmd) == 0 {
+		return
+	}
+	for _, w := range app.cmd {
+		if !w.runing || !w.ready {
+			return
+		}
+	}
+	m.notified = true
+	systemd.notify("READY=1")
+}
+
+//ready mark the work process of pid is ready to serve
+func (m *master) ready(pid int) {
+	for i := range app.cmd {
+		w := &app.cmd[i]
+		if w.cmd != nil && w.cmd.Process != nil && w.cmd.Process.Pid == pid {
+			w.ready = true
+		}
+	}
+}
+
+//watchdog ping the watchdog of systemd when no work process is failed(crash looping)
+//systemd restarts the service when the pings stop
+func (m *master) watchdog() {
+	for _, w := range app.cmd {
+		if w.failed {
+			return
+		}
+	}
+	systemd.notify("WATCHDOG=1")
+}
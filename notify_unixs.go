@@ -0,0 +1,16 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// +build !windows
+
+package bast
+
+import "golang.org/x/sys/unix"
+
+//monotonic return the CLOCK_MONOTONIC in microseconds(see MONOTONIC_USEC of sd_notify)
+func monotonic() int64 {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0
+	}
+	return ts.Nano() / 1000
+}
@@ -0,0 +1,10 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// +build windows
+
+package bast
+
+//monotonic is not supported
+func monotonic() int64 {
+	return 0
+}
@@ -0,0 +1,251 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/logs"
+	"github.com/axfor/bast/openapi"
+)
+
+//Request set the request type of api doc(see OpenAPI)
+//the fields are query parameters for GET/HEAD/DELETE, otherwise it's request body
+func (c *Pattern) Request(v interface{}) *Pattern {
+	c.request = v
+	return c
+}
+
+//Response set the response data type of api doc(see OpenAPI)
+func (c *Pattern) Response(v interface{}) *Pattern {
+	c.response = v
+	return c
+}
+
+//PageResponse set the pagination response data type of api doc(see OpenAPI and Context.Page)
+func (c *Pattern) PageResponse(v interface{}) *Pattern {
+	c.response = v
+	c.page = true
+	return c
+}
+
+//Summary set the summary of api doc(see OpenAPI)
+func (c *Pattern) Summary(summary string) *Pattern {
+	c.summary = summary
+	return c
+}
+
+//OpenAPI generate OpenAPI 3 document from all registered routes
+func OpenAPI() *openapi.Document {
+	c := conf.OpenAPI()
+	doc := openapi.New(c.Title, c.Version)
+	doc.Info.Description = c.Description
+	if ac := conf.Conf(); ac != nil && ac.BaseURL != "" {
+		doc.Servers = []openapi.Server{{URL: ac.BaseURL}}
+	}
+	keys := make([]string, 0, len(app.pattern))
+	for k, p := range app.pattern {
+		if p.Fn != nil && !p.hidden {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := app.pattern[keys[i]], app.pattern[keys[j]]
+		if pi.Pattern == pj.Pattern {
+			return pi.Method < pj.Method
+		}
+		return pi.Pattern < pj.Pattern
+	})
+	for _, k := range keys {
+		p := app.pattern[k]
+		path, op := operation(doc, p)
+		doc.AddOperation(path, p.Method, op)
+	}
+	for name, s := range app.schemes {
+		doc.Components.SecuritySchemes[name] = securityScheme(s)
+	}
+	return doc
+}
+
+//operation return the api doc of pattern
+func operation(doc *openapi.Document, p *Pattern) (string, *openapi.Operation) {
+	path, params := openapi.Path(p.Pattern)
+	op := &openapi.Operation{
+		OperationID: p.Name,
+		Summary:     p.summary,
+		Parameters:  params,
+		Responses:   map[string]*openapi.Response{},
+	}
+	if p.Service != "" {
+		op.Tags = []string{p.Service}
+	}
+	if p.request != nil {
+		switch p.Method {
+		case http.MethodGet, http.MethodHead, http.MethodDelete:
+			op.Parameters = append(op.Parameters, doc.Parameters(p.request)...)
+		default:
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: content(doc.Schema(p.request))}
+		}
+	}
+	if p.page && (p.Method == http.MethodGet || p.Method == http.MethodHead) {
+		for _, name := range []string{app.page.Page, app.page.Total, app.page.PageRow} {
+			op.Parameters = append(op.Parameters, &openapi.Parameter{Name: name, In: "query", Schema: &openapi.Schema{Type: "integer", Format: "int32"}})
+		}
+	}
+	ok := &openapi.Response{Description: http.StatusText(http.StatusOK)}
+	if p.response != nil {
+		s := doc.Schema(p.response)
+		if app.wrap && p.page {
+			s = openapi.Pagination(s)
+		} else if app.wrap {
+			s = openapi.Datum(s)
+		}
+		ok.Content = content(s)
+	}
+	op.Responses["200"] = ok
+	if p.authorization {
+		if len(p.schemes) > 0 {
+			if p.allSchemes {
+				r := openapi.SecurityRequirement{}
+				for _, s := range p.schemes {
+					r[s] = []string{}
+				}
+				op.Security = append(op.Security, r)
+			} else {
+				for _, s := range p.schemes {
+					op.Security = append(op.Security, openapi.SecurityRequirement{s: []string{}})
+				}
+			}
+		}
+		op.Responses["401"] = &openapi.Response{Description: http.StatusText(http.StatusUnauthorized)}
+	}
+	if len(p.roles) > 0 || len(p.permissions) > 0 {
+		op.Responses["403"] = &openapi.Response{Description: http.StatusText(http.StatusForbidden)}
+	}
+	return path, op
+}
+
+//content return the schema of each response kind(json,xml,yaml)
+func content(s *openapi.Schema) map[string]*openapi.MediaType {
+	m := &openapi.MediaType{Schema: s}
+	return map[string]*openapi.MediaType{
+		"application/json":   m,
+		"application/xml":    m,
+		"application/x+yaml": m,
+	}
+}
+
+//securityScheme return the api doc of authorization scheme
+//it's http scheme when challenge is Basic or Bearer, otherwise it's apiKey of header
+func securityScheme(s *authScheme) *openapi.SecurityScheme {
+	challenge := strings.ToLower(s.challenge)
+	if strings.HasPrefix(challenge, "bearer") {
+		ss := &openapi.SecurityScheme{Type: "http", Scheme: "bearer"}
+		if s.name == "jwt" {
+			ss.BearerFormat = "JWT"
+		}
+		return ss
+	}
+	if strings.HasPrefix(challenge, "basic") {
+		return &openapi.SecurityScheme{Type: "http", Scheme: "basic"}
+	}
+	return &openapi.SecurityScheme{Type: "apiKey", In: "header", Name: "Authorization", Description: s.challenge}
+}
+
+//openAPIRouter register the OpenAPI document route when it's enabled
+//and the api explorer route when it's configured(only for debug or authorization schemes)
+func openAPIRouter(c *conf.OpenAPIConf) {
+	if c.Enable && c.Path != "" {
+		if _, ok := app.pattern[http.MethodGet+c.Path]; !ok {
+			Get(c.Path, func(ctx *Context) {
+				serveOpenAPI(ctx, c.Path)
+			}).hidden = true
+		}
+	}
+	prefix := cleanPrefix(c.UI)
+	if prefix == "" {
+		return
+	}
+	ac := conf.Conf()
+	if !app.Debug && (ac == nil || !ac.Debug) && len(c.Auth) == 0 {
+		logs.Info("openapi ui is disabled, it needs debug or authorization schemes", logs.String("path", prefix))
+		return
+	}
+	if _, ok := app.pattern[http.MethodGet+prefix+"/*filepath"]; ok {
+		return
+	}
+	fs := http.FileServer(openapi.UI())
+	p := Get(prefix+"/*filepath", func(ctx *Context) {
+		fp := ctx.GetParam("filepath")
+		if fp == "/openapi.json" {
+			serveOpenAPI(ctx, fp)
+			return
+		}
+		r := ctx.In.Clone(ctx.In.Context())
+		r.URL.Path = fp
+		fs.ServeHTTP(ctx.Out, r)
+	})
+	p.hidden = true
+	if len(c.Auth) > 0 {
+		p.Auth(c.Auth...)
+	}
+}
+
+//serveOpenAPI output OpenAPI document to client
+//the servers are BaseURL of app config and BaseURL of current request(see Context.BaseURL)
+func serveOpenAPI(ctx *Context, name string) {
+	doc := OpenAPI()
+	base := strings.TrimRight(ctx.BaseURL(), "/")
+	has := false
+	for _, s := range doc.Servers {
+		if strings.TrimRight(s.URL, "/") == base {
+			has = true
+		}
+	}
+	if !has {
+		doc.Servers = append(doc.Servers, openapi.Server{URL: base})
+	}
+	data, err := openAPIData(doc, name)
+	if err != nil {
+		ctx.Failed("openapi error", err)
+		return
+	}
+	if isYAML(name) {
+		ctx.Out.Header().Set("Content-Type", "application/x+yaml")
+	} else {
+		ctx.Out.Header().Set("Content-Type", "application/json")
+	}
+	ctx.Say(data)
+}
+
+//exportOpenAPI write OpenAPI document to file(json or yaml by extension)
+func exportOpenAPI(file string) error {
+	data, err := openAPIData(OpenAPI(), file)
+	if err == nil {
+		err = ioutil.WriteFile(file, data, 0644)
+	}
+	if err != nil {
+		fmt.Println("export openapi failed," + err.Error())
+		return err
+	}
+	fmt.Println("export openapi success")
+	return nil
+}
+
+func openAPIData(doc *openapi.Document, name string) ([]byte, error) {
+	if isYAML(name) {
+		return doc.YAML()
+	}
+	return doc.JSON()
+}
+
+func isYAML(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".yaml" || ext == ".yml"
+}
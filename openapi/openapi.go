@@ -0,0 +1,204 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// Package openapi provides OpenAPI 3.0 document model
+// and schema generation from go types(json and v tags).
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+//Version is OpenAPI version
+const Version = "3.0.3"
+
+//Document is OpenAPI document
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Servers    []Server              `json:"servers,omitempty"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components *Components           `json:"components,omitempty"`
+	Security   []SecurityRequirement `json:"security,omitempty"`
+	Tags       []Tag                 `json:"tags,omitempty"`
+	generator  *Generator
+}
+
+//Info is API metadata
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+//Server is API server
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+//Tag is operation tag
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+//PathItem is the operations of a path
+type PathItem struct {
+	Get     *Operation `json:"get,omitempty"`
+	Put     *Operation `json:"put,omitempty"`
+	Post    *Operation `json:"post,omitempty"`
+	Delete  *Operation `json:"delete,omitempty"`
+	Options *Operation `json:"options,omitempty"`
+	Head    *Operation `json:"head,omitempty"`
+	Patch   *Operation `json:"patch,omitempty"`
+}
+
+//Operation is an API operation of path
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []SecurityRequirement `json:"security,omitempty"`
+}
+
+//Parameter is an operation parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` //path|query|header|cookie
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+//RequestBody is an operation request body
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+//Response is an operation response
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+//Header is a response header
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+//MediaType is the schema of a content type
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+//Components is reusable objects
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+//SecurityScheme is an authorization scheme
+type SecurityScheme struct {
+	Type         string `json:"type"` //apiKey|http|oauth2|openIdConnect
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+//SecurityRequirement is the required schemes of operation
+type SecurityRequirement map[string][]string
+
+//New create a Document
+func New(title, version string) *Document {
+	d := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   map[string]*PathItem{},
+		Components: &Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]*SecurityScheme{},
+		},
+	}
+	d.generator = NewGenerator(d.Components.Schemas)
+	return d
+}
+
+//Schema return the schema of v(see Generator)
+func (d *Document) Schema(v interface{}) *Schema {
+	return d.generator.Schema(v)
+}
+
+//Parameters return the query parameters of struct v(see Generator)
+func (d *Document) Parameters(v interface{}) []*Parameter {
+	return d.generator.Parameters(v)
+}
+
+//AddOperation add the operation of path and method
+func (d *Document) AddOperation(path, method string, op *Operation) {
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	switch strings.ToUpper(method) {
+	case "GET":
+		item.Get = op
+	case "PUT":
+		item.Put = op
+	case "POST":
+		item.Post = op
+	case "DELETE":
+		item.Delete = op
+	case "OPTIONS":
+		item.Options = op
+	case "HEAD":
+		item.Head = op
+	case "PATCH":
+		item.Patch = op
+	}
+}
+
+//JSON return json of document
+func (d *Document) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+//YAML return yaml of document
+func (d *Document) YAML() ([]byte, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err = yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(v)
+}
+
+//Path convert router pattern(/users/:id/*path) to OpenAPI path(/users/{id}/{path})
+//and return the path parameters
+func Path(pattern string) (string, []*Parameter) {
+	ss := strings.Split(pattern, "/")
+	ps := []*Parameter{}
+	for i, s := range ss {
+		if len(s) > 1 && (s[0] == ':' || s[0] == '*') {
+			ss[i] = "{" + s[1:] + "}"
+			ps = append(ps, &Parameter{Name: s[1:], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	return strings.Join(ss, "/"), ps
+}
@@ -0,0 +1,77 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package openapi
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+type base struct {
+	ID int64 `json:"id"`
+}
+
+type person struct {
+	base
+	XMLName  xml.Name  `xml:"person" json:"-"`
+	Name     string    `json:"name" v:"required|min:1|max:12"`
+	Age      int       `json:"age" v:"min:1|max:150"`
+	Email    string    `json:"email,omitempty" v:"email"`
+	Birthday string    `json:"birthday" v:"date"`
+	Tags     []string  `json:"tags" v:"max:3"`
+	Created  time.Time `json:"created"`
+	Friends  []*person `json:"friends"`
+	secret   string
+}
+
+func Test_Schema(t *testing.T) {
+	d := New("bast", "1.0.0")
+	s := d.Schema(&person{})
+	if s.Ref != "#/components/schemas/person" {
+		t.Fatal(s.Ref)
+	}
+	p := d.Components.Schemas["person"]
+	if p == nil || len(p.Properties) != 8 {
+		t.Fatal(p)
+	}
+	if len(p.Required) != 1 || p.Required[0] != "name" {
+		t.Error(p.Required)
+	}
+	if n := p.Properties["name"]; *n.MinLength != 1 || *n.MaxLength != 12 {
+		t.Error(n)
+	}
+	if a := p.Properties["age"]; a.Type != "integer" || *a.Minimum != 1 || *a.Maximum != 150 {
+		t.Error(a)
+	}
+	if p.Properties["email"].Format != "email" || p.Properties["birthday"].Format != "date" {
+		t.Error(p.Properties["email"], p.Properties["birthday"])
+	}
+	if tg := p.Properties["tags"]; tg.Type != "array" || *tg.MaxItems != 3 {
+		t.Error(tg)
+	}
+	if p.Properties["created"].Format != "date-time" || p.Properties["id"].Format != "int64" {
+		t.Error(p.Properties["created"])
+	}
+	if f := p.Properties["friends"]; f.Items.Ref != s.Ref {
+		t.Error(f.Items)
+	}
+
+	ps := d.Parameters(person{})
+	if len(ps) != 8 || ps[0].Name != "age" || ps[0].In != "query" {
+		t.Error(ps)
+	}
+	if _, err := d.JSON(); err != nil {
+		t.Error(err)
+	}
+	if _, err := d.YAML(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Path(t *testing.T) {
+	p, ps := Path("/users/:id/files/*path")
+	if p != "/users/{id}/files/{path}" || len(ps) != 2 || ps[1].Name != "path" || !ps[0].Required {
+		t.Error(p, ps)
+	}
+}
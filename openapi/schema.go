@@ -0,0 +1,314 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package openapi
+
+import (
+	"encoding/xml"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Schema is OpenAPI schema object
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int64             `json:"minLength,omitempty"`
+	MaxLength            *int64             `json:"maxLength,omitempty"`
+	MinItems             *int64             `json:"minItems,omitempty"`
+	MaxItems             *int64             `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	xmlNameType = reflect.TypeOf(xml.Name{})
+	bytesType   = reflect.TypeOf([]byte{})
+)
+
+//Generator generate schemas from go types
+//named struct types are added to the components schemas and referenced by $ref
+type Generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+//NewGenerator create a Generator with the components schemas
+func NewGenerator(schemas map[string]*Schema) *Generator {
+	return &Generator{schemas: schemas, names: map[reflect.Type]string{}}
+}
+
+//Schema return the schema of v
+//v is a value or a reflect.Type
+func (g *Generator) Schema(v interface{}) *Schema {
+	if v == nil {
+		return &Schema{}
+	}
+	t, ok := v.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(v)
+	}
+	return g.schema(t)
+}
+
+//Parameters return the query parameters of struct v
+func (g *Generator) Parameters(v interface{}) []*Parameter {
+	t, ok := v.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(v)
+	}
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fields(t, s)
+	required := map[string]bool{}
+	for _, r := range s.Required {
+		required[r] = true
+	}
+	ps := []*Parameter{}
+	for _, name := range sortedKeys(s.Properties) {
+		ps = append(ps, &Parameter{Name: name, In: "query", Required: required[name], Schema: s.Properties[name]})
+	}
+	return ps
+}
+
+func (g *Generator) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case bytesType:
+		return &Schema{Type: "string", Format: "byte"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+			g.fields(t, s)
+			return s
+		}
+		name, ok := g.names[t]
+		if !ok {
+			name = g.name(t)
+			g.names[t] = name
+			s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+			g.schemas[name] = s
+			g.fields(t, s)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+//name return an unique component name of t
+func (g *Generator) name(t reflect.Type) string {
+	name := t.Name()
+	if _, ok := g.schemas[name]; !ok {
+		return name
+	}
+	pkg := t.PkgPath()
+	if pos := strings.LastIndex(pkg, "/"); pos != -1 {
+		pkg = pkg[pos+1:]
+	}
+	name = pkg + "." + t.Name()
+	n := name
+	for i := 2; ; i++ {
+		if _, ok := g.schemas[n]; !ok {
+			return n
+		}
+		n = name + strconv.Itoa(i)
+	}
+}
+
+//fields add the fields of struct t to s
+func (g *Generator) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type == xmlNameType {
+			continue
+		}
+		name, omit := jsonName(f)
+		if omit {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, s)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fs := g.schema(f.Type)
+		if applyRules(fs, f.Tag.Get("v")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+	}
+}
+
+//jsonName return json name of field and whether it's omitted
+func jsonName(f reflect.StructField) (string, bool) {
+	js := f.Tag.Get("json")
+	if js == "-" {
+		return "", true
+	}
+	if pos := strings.Index(js, ","); pos != -1 {
+		js = js[0:pos]
+	}
+	return js, false
+}
+
+//applyRules apply v tag(such as: key/split@required|min:1|max:12|email) to schema
+//and return whether it's required
+func applyRules(s *Schema, tag string) bool {
+	if tag == "" {
+		return false
+	}
+	split := "|"
+	if pos := strings.Index(tag, "@"); pos != -1 {
+		k := tag[0:pos]
+		tag = tag[pos+1:]
+		if pos = strings.Index(k, "/"); pos != -1 && k[pos+1:] != "" {
+			split = k[pos+1:]
+		}
+	}
+	required := false
+	if s.Ref != "" {
+		//$ref siblings are ignored, so only required is applied
+		for _, r := range strings.Split(tag, split) {
+			if r == "required" {
+				required = true
+			}
+		}
+		return required
+	}
+	for _, r := range strings.Split(tag, split) {
+		name, param := r, ""
+		if pos := strings.Index(r, ":"); pos != -1 {
+			name = r[0:pos]
+			param = r[pos+1:]
+		}
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "date":
+			s.Format = "date"
+		case "ip":
+			s.Format = "ipv4"
+		case "int":
+			if s.Type == "string" {
+				s.Pattern = `^-?\d+$`
+			}
+		case "match":
+			s.Pattern = param
+		case "min", "max":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			limit(s, name == "min", n)
+		}
+	}
+	return required
+}
+
+func limit(s *Schema, min bool, n float64) {
+	i := int64(n)
+	switch s.Type {
+	case "integer", "number":
+		if min {
+			s.Minimum = &n
+		} else {
+			s.Maximum = &n
+		}
+	case "string":
+		if min {
+			s.MinLength = &i
+		} else {
+			s.MaxLength = &i
+		}
+	case "array":
+		if min {
+			s.MinItems = &i
+		} else {
+			s.MaxItems = &i
+		}
+	}
+}
+
+//Datum wrap schema with the response envelope {code,msg,data}
+func Datum(data *Schema) *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"code": {Type: "integer", Format: "int32"},
+			"msg":  {Type: "string"},
+			"data": data,
+		},
+	}
+}
+
+func sortedKeys(m map[string]*Schema) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+//Pagination wrap schema with the pagination response envelope {code,msg,data,page,total}
+func Pagination(data *Schema) *Schema {
+	if data.Type != "array" {
+		data = &Schema{Type: "array", Items: data}
+	}
+	s := Datum(data)
+	s.Properties["page"] = &Schema{Type: "integer", Format: "int32"}
+	s.Properties["total"] = &Schema{Type: "integer", Format: "int32"}
+	return s
+}
@@ -0,0 +1,22 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package openapi
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed ui
+var ui embed.FS
+
+//UI return the file system of the self-contained api explorer
+//the explorer loads document from 'openapi.json' of the same directory
+func UI() http.FileSystem {
+	sub, err := fs.Sub(ui, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return http.FS(sub)
+}
@@ -0,0 +1,61 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package pipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFrame(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, &Message{Cmd: "status", Data: json.RawMessage(`{"pid":1}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if n := buf.Len(); n != 4+len(`{"cmd":"status","data":{"pid":1}}`) {
+		t.Fatal(n)
+	}
+	m, err := Read(&buf)
+	if err != nil || m.Cmd != "status" || string(m.Data) != `{"pid":1}` {
+		t.Fatal(m, err)
+	}
+	buf.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	if _, err := Read(&buf); err != ErrFrameTooLarge {
+		t.Fatal(err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	name := "bast-pipe-test-" + strconv.Itoa(os.Getpid())
+	l, err := Listen(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go Serve(l, func(req *Message) (interface{}, error) {
+		switch req.Cmd {
+		case "echo":
+			var v map[string]string
+			json.Unmarshal(req.Data, &v)
+			return v, nil
+		case "panic":
+			panic("boom")
+		}
+		return nil, errors.New("unknown command " + req.Cmd)
+	})
+	var v map[string]string
+	if err := Call(name, "echo", map[string]string{"level": "debug"}, &v, time.Second); err != nil || v["level"] != "debug" {
+		t.Fatal(v, err)
+	}
+	if err := Call(name, "stop", nil, nil, time.Second); err == nil || err.Error() != "unknown command stop" {
+		t.Fatal(err)
+	}
+	if err := Call(name, "panic", nil, nil, time.Second); err == nil {
+		t.Fatal("panic is not returned")
+	}
+}
@@ -0,0 +1,147 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package pipe
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+//MaxFrame is the max size of a frame
+const MaxFrame = 4 << 20
+
+//idleTimeout is the max idle time of a connection in Serve
+const idleTimeout = time.Minute
+
+//ErrFrameTooLarge the frame is larger than MaxFrame
+var ErrFrameTooLarge = errors.New("pipe frame too large")
+
+//Message is a request or response of the control protocol between master and work processes
+//a frame is the 4 bytes(big endian) length and the json of message
+type Message struct {
+	Cmd   string          `json:"cmd"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+//Handler handle a request, the result is the data of response
+type Handler func(req *Message) (interface{}, error)
+
+//Write write a frame of message
+func Write(w io.Writer, m *Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxFrame {
+		return ErrFrameTooLarge
+	}
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	_, err = w.Write(buf)
+	return err
+}
+
+//Read read a frame of message
+func Read(r io.Reader) (*Message, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(head[:])
+	if n > MaxFrame {
+		return nil, ErrFrameTooLarge
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	m := &Message{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+//Serve serve the requests of listener until it's closed, a connection can send many requests
+func Serve(l net.Listener, h Handler) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveConn(conn, h)
+	}
+}
+
+//serveConn serve the requests of connection
+func serveConn(conn net.Conn, h Handler) {
+	defer conn.Close()
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		req, err := Read(conn)
+		if err != nil {
+			return
+		}
+		rsp := &Message{Cmd: req.Cmd}
+		v, err := handle(h, req)
+		if err != nil {
+			rsp.Error = err.Error()
+		} else if v != nil {
+			if rsp.Data, err = json.Marshal(v); err != nil {
+				rsp.Error = err.Error()
+			}
+		}
+		conn.SetWriteDeadline(time.Now().Add(idleTimeout))
+		if Write(conn, rsp) != nil {
+			return
+		}
+	}
+}
+
+//handle call the handler, the panic is returned as error
+func handle(h Handler, req *Message) (v interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.New("pipe handler panic")
+		}
+	}()
+	return h(req)
+}
+
+//Call send a request to the pipe of name and decode the data of response to v(can be nil)
+func Call(name, cmd string, data, v interface{}, timeout time.Duration) error {
+	conn, err := Dial(name)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	req := &Message{Cmd: cmd}
+	if data != nil {
+		if req.Data, err = json.Marshal(data); err != nil {
+			return err
+		}
+	}
+	if err = Write(conn, req); err != nil {
+		return err
+	}
+	rsp, err := Read(conn)
+	if err != nil {
+		return err
+	}
+	if rsp.Error != "" {
+		return errors.New(rsp.Error)
+	}
+	if v != nil && len(rsp.Data) > 0 {
+		return json.Unmarshal(rsp.Data, v)
+	}
+	return nil
+}
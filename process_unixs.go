@@ -0,0 +1,28 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// +build !windows
+
+package bast
+
+import (
+	"syscall"
+	"time"
+)
+
+//processAlive return the process of pid is alive(signal 0 is sent)
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+//waitProcess wait the process of pid is exited, false is it's alive after timeout
+func waitProcess(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// +build windows
+
+package bast
+
+import (
+	"os"
+	"time"
+)
+
+//processAlive return the process of pid is alive(the process can be opened)
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+//waitProcess wait the process of pid is exited, false is it's alive after timeout
+func waitProcess(pid int, timeout time.Duration) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		p.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
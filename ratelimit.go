@@ -0,0 +1,171 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/logs"
+	"github.com/axfor/bast/ratelimit"
+)
+
+//LimitKey return the rate limit key of request(such as: client ip)
+type LimitKey func(ctx *Context) string
+
+//limiter is a rate limit of routes
+type limiter struct {
+	scope  string //routes of same scope share the quota
+	policy ratelimit.Policy
+	key    LimitKey
+	late   bool //check it after authorization
+}
+
+var limitKeys = map[string]LimitKey{
+	ratelimit.KeyIP:        LimitByIP,
+	ratelimit.KeySession:   LimitBySession,
+	ratelimit.KeyPrincipal: LimitByPrincipal,
+}
+
+//LimitByIP limit request by client ip
+func LimitByIP(ctx *Context) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+//LimitBySession limit request by session id, it's client ip if session is disabled
+func LimitBySession(ctx *Context) string {
+	if id := ctx.SessionID(); id != "" {
+		return "session:" + id
+	}
+	return LimitByIP(ctx)
+}
+
+//LimitByPrincipal limit request by principal(see Policy), it's client ip for anonymous
+func LimitByPrincipal(ctx *Context) string {
+	if p := ctx.Principal(); p != nil && p.ID != "" {
+		return "principal:" + p.ID
+	}
+	return LimitByIP(ctx)
+}
+
+//newLimiter create a limiter, the key of policy(ip|session|principal) is used if key is nil
+//principal and custom key are checked after authorization, others are before it
+func newLimiter(scope string, p ratelimit.Policy, key ...LimitKey) *limiter {
+	l := &limiter{scope: scope, policy: p}
+	if len(key) > 0 && key[0] != nil {
+		l.key = key[0]
+		l.late = true
+	} else if f, ok := limitKeys[p.Key]; ok {
+		l.key = f
+		l.late = p.Key == ratelimit.KeyPrincipal
+	} else {
+		l.key = LimitByIP
+	}
+	return l
+}
+
+//RateLimit limit the requests of api, key is the client of quota(default is Key of policy)
+func (c *Pattern) RateLimit(p ratelimit.Policy, key ...LimitKey) *Pattern {
+	c.limiters = append(c.limiters, newLimiter(c.Method+c.Pattern, p, key...))
+	return c
+}
+
+//RateLimit limit the requests of group routes, all routes of group share the quota
+//key is the client of quota(default is Key of policy)
+func (g *RouterGroup) RateLimit(p ratelimit.Policy, key ...LimitKey) *RouterGroup {
+	g.limiters = append(g.limiters, newLimiter("group:"+g.prefix, p, key...))
+	return g
+}
+
+//RateLimitStore set the store of rate limit(default is the engine of 'rateLimit' app config)
+func RateLimitStore(s ratelimit.Store) {
+	app.limitStore = s
+}
+
+//initRateLimit init the default limiter, rules and store from the 'rateLimit' app config
+//redis engine use the redis of session config when it's not configured
+func initRateLimit(c *ratelimit.Conf) {
+	app.limiters = nil
+	app.limitRules = map[string]*limiter{}
+	//the memory store is used by the limits of routes(see Pattern.RateLimit) when it's disabled
+	app.limitStore = ratelimit.NewMemory()
+	if !c.Enable {
+		return
+	}
+	if c.Limit > 0 {
+		app.limiters = append(app.limiters, newLimiter("*", c.Policy))
+	}
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		app.limitRules[r.Method+r.Pattern] = newLimiter(r.Method+r.Pattern, r.Policy)
+	}
+	if c.Engine == "redis" && c.Redis == nil {
+		if s := conf.Session(); s != nil {
+			c.Redis = s.Redis
+		}
+	}
+	s, err := ratelimit.New(c)
+	if err != nil {
+		logs.Errors("rate limit init failed, use memory store", err)
+		return
+	}
+	app.limitStore = s
+}
+
+//limit check the rate limits of current route and output 429 to client when it's exceeded
+//late is whether check the limiters after authorization
+func limit(ctx *Context, late bool) bool {
+	pattern := ctx.Router
+	if pattern.probe {
+		return true
+	}
+	ls := make([]*limiter, 0, len(app.limiters)+len(pattern.limiters)+1)
+	ls = append(append(ls, app.limiters...), pattern.limiters...)
+	if r, ok := app.limitRules[pattern.Method+pattern.Pattern]; ok {
+		ls = append(ls, r)
+	}
+	for _, l := range ls {
+		if l.late != late || l.policy.Limit <= 0 {
+			continue
+		}
+		r, err := app.limitStore.Take(l.scope+"|"+l.key(ctx), &l.policy)
+		if err != nil {
+			ctx.Log().Errors("rate limit error", err)
+			continue
+		}
+		if ctx.rateLimit == nil || !r.Allowed || r.Remaining < ctx.rateLimit.Remaining {
+			ctx.rateLimit = r
+		}
+		if !r.Allowed {
+			break
+		}
+	}
+	r := ctx.rateLimit
+	if r == nil {
+		return true
+	}
+	h := ctx.Out.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(r.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(r.Remaining))
+	h.Set("RateLimit-Reset", seconds(r.Reset))
+	if r.Allowed {
+		return true
+	}
+	h.Set("Retry-After", seconds(r.RetryAfter))
+	ctx.Log().Warn("rate-limited",
+		logs.String("url", ctx.In.RequestURI),
+		logs.String("method", ctx.In.Method),
+		logs.String("ip", ctx.ClientIP()),
+	)
+	ctx.Status(http.StatusTooManyRequests)
+	ctx.FailResult(http.StatusText(http.StatusTooManyRequests), SerTry)
+	return false
+}
+
+//seconds return the ceil seconds of d
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,68 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+//recycle the idle keys for each recycleCount takes
+const recycleCount = 1024
+
+//Memory is in-process store
+type Memory struct {
+	lock    sync.Mutex
+	buckets map[string]*bucket
+	windows map[string]*window
+	count   int
+	now     func() time.Time
+}
+
+//NewMemory create in-process store
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: map[string]*bucket{},
+		windows: map[string]*window{},
+		now:     time.Now,
+	}
+}
+
+//Take take a request from the quota of key
+func (m *Memory) Take(key string, p *Policy) (*Result, error) {
+	now := m.now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.count++
+	if m.count%recycleCount == 0 {
+		m.recycle(now)
+	}
+	if p.Algorithm == TokenBucket {
+		b, ok := m.buckets[key]
+		if !ok {
+			b = &bucket{}
+			m.buckets[key] = b
+		}
+		return b.take(p, now), nil
+	}
+	w, ok := m.windows[key]
+	if !ok {
+		w = &window{}
+		m.windows[key] = w
+	}
+	return w.take(p, now), nil
+}
+
+//recycle delete the expired keys(their states are same as new keys)
+func (m *Memory) recycle(now time.Time) {
+	for k, b := range m.buckets {
+		if now.After(b.expire) {
+			delete(m.buckets, k)
+		}
+	}
+	for k, w := range m.windows {
+		if now.After(w.expire) {
+			delete(m.windows, k)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// Package ratelimit provides token-bucket and sliding-window rate limiter
+//with in-memory and redis stores.
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	sessionConf "github.com/axfor/bast/session/conf"
+)
+
+//algorithms
+const (
+	TokenBucket   = "token-bucket"
+	SlidingWindow = "sliding-window"
+)
+
+//key kinds of Policy
+const (
+	KeyIP        = "ip"
+	KeySession   = "session"
+	KeyPrincipal = "principal"
+)
+
+//ErrorNotFondRedisConf not fond redis conf
+var ErrorNotFondRedisConf = errors.New("not fond redis conf of rate limit")
+
+//Policy is a rate limit policy
+type Policy struct {
+	Algorithm string `json:"algorithm"` //token-bucket|sliding-window(default)
+	Limit     int    `json:"limit"`     //requests of each window, zero is unlimited
+	Window    int64  `json:"window"`    //window(second), default is 1
+	Burst     int    `json:"burst"`     //token bucket capacity(default is limit)
+	Key       string `json:"key"`       //ip|session|principal(default is ip)
+}
+
+//Rule is the policy of route
+type Rule struct {
+	Method  string `json:"method"`  //GET
+	Pattern string `json:"pattern"` //such as: /api/users/:id
+	Policy
+}
+
+//Conf is rate limit config
+type Conf struct {
+	Enable bool                   `json:"enable"`
+	Policy                        //default policy of each client(all routes are shared)
+	Engine string                 `json:"engine"` //memory|redis(default is memory)
+	Prefix string                 `json:"prefix"` //key prefix of redis(default is ratelimit:)
+	Redis  *sessionConf.RedisConf `json:"redis"`  //default is redis of session config
+	Rules  []Rule                 `json:"rules"`  //route rules
+}
+
+//Result is the result of take
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration //time until the quota is fully restored
+	RetryAfter time.Duration //time until next request is allowed(only for denied)
+}
+
+//Store is rate limit store
+type Store interface {
+	//Take take a request from the quota of key
+	Take(key string, p *Policy) (*Result, error)
+}
+
+//New create a store by engine of config(memory or redis)
+func New(c *Conf) (Store, error) {
+	if c != nil && c.Engine == "redis" {
+		return NewRedis(c.Redis, c.Prefix)
+	}
+	return NewMemory(), nil
+}
+
+//window return window of policy
+func (p *Policy) window() time.Duration {
+	if p.Window <= 0 {
+		return time.Second
+	}
+	return time.Duration(p.Window) * time.Second
+}
+
+//burst return token bucket capacity of policy
+func (p *Policy) burst() int {
+	if p.Burst > 0 {
+		return p.Burst
+	}
+	return p.Limit
+}
+
+//bucket is state of token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+	expire time.Time //the bucket is full after expire
+}
+
+//take refill and take a token from bucket
+func (b *bucket) take(p *Policy, now time.Time) *Result {
+	capacity := float64(p.burst())
+	rate := float64(p.Limit) / float64(p.window()) //tokens of each nanosecond
+	if b.last.IsZero() {
+		b.tokens = capacity
+	} else if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+float64(elapsed)*rate)
+	}
+	b.last = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	r := bucketResult(p, allowed, b.tokens)
+	b.expire = now.Add(r.Reset)
+	return r
+}
+
+func bucketResult(p *Policy, allowed bool, tokens float64) *Result {
+	capacity := float64(p.burst())
+	rate := float64(p.Limit) / float64(p.window())
+	r := &Result{
+		Allowed:   allowed,
+		Limit:     p.burst(),
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration(math.Ceil((capacity - tokens) / rate)),
+	}
+	if !allowed {
+		r.RetryAfter = time.Duration(math.Ceil((1 - tokens) / rate))
+	}
+	return r
+}
+
+//window is state of sliding window(weighted previous and current window counter)
+type window struct {
+	start    time.Time
+	current  int
+	previous int
+	expire   time.Time //the counters are zero after expire
+}
+
+//take count a request to sliding window
+func (w *window) take(p *Policy, now time.Time) *Result {
+	size := p.window()
+	start := now.Truncate(size)
+	if !w.start.Equal(start) {
+		if w.start.Equal(start.Add(-size)) {
+			w.previous = w.current
+		} else {
+			w.previous = 0
+		}
+		w.current = 0
+		w.start = start
+		w.expire = start.Add(2 * size)
+	}
+	count := slidingCount(w.previous, w.current, now.Sub(start), size)
+	allowed := count+1 <= float64(p.Limit)
+	if allowed {
+		w.current++
+		count++
+	}
+	return windowResult(p, allowed, count, now.Sub(start))
+}
+
+func slidingCount(previous, current int, elapsed, size time.Duration) float64 {
+	return float64(previous)*(1-float64(elapsed)/float64(size)) + float64(current)
+}
+
+func windowResult(p *Policy, allowed bool, count float64, elapsed time.Duration) *Result {
+	reset := p.window() - elapsed
+	r := &Result{
+		Allowed:   allowed,
+		Limit:     p.Limit,
+		Remaining: p.Limit - int(math.Ceil(count)),
+		Reset:     reset,
+	}
+	if r.Remaining < 0 {
+		r.Remaining = 0
+	}
+	if !allowed {
+		r.RetryAfter = reset
+	}
+	return r
+}
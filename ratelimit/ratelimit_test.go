@@ -0,0 +1,60 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_TokenBucket(t *testing.T) {
+	now := time.Unix(1000, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	p := &Policy{Algorithm: TokenBucket, Limit: 2, Window: 1, Burst: 3}
+	for i := 0; i < 3; i++ {
+		if r, _ := m.Take("a", p); !r.Allowed || r.Remaining != 2-i || r.Limit != 3 {
+			t.Fatal(i, r)
+		}
+	}
+	r, _ := m.Take("a", p)
+	if r.Allowed || r.RetryAfter != 500*time.Millisecond {
+		t.Fatal(r)
+	}
+	if r, _ := m.Take("b", p); !r.Allowed {
+		t.Fatal(r)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if r, _ := m.Take("a", p); !r.Allowed || r.Remaining != 0 {
+		t.Fatal(r)
+	}
+}
+
+func Test_SlidingWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	p := &Policy{Limit: 4, Window: 10}
+	for i := 0; i < 4; i++ {
+		if r, _ := m.Take("a", p); !r.Allowed || r.Remaining != 3-i {
+			t.Fatal(i, r)
+		}
+	}
+	if r, _ := m.Take("a", p); r.Allowed || r.RetryAfter != 10*time.Second {
+		t.Fatal(r)
+	}
+	//previous window weight is 0.5, 4*0.5=2 requests are left
+	now = now.Add(15 * time.Second)
+	for i := 0; i < 2; i++ {
+		if r, _ := m.Take("a", p); !r.Allowed {
+			t.Fatal(i, r)
+		}
+	}
+	if r, _ := m.Take("a", p); r.Allowed || r.Remaining != 0 {
+		t.Fatal(r)
+	}
+	now = now.Add(time.Hour)
+	if r, _ := m.Take("a", p); !r.Allowed || r.Remaining != 3 {
+		t.Fatal(r)
+	}
+}
@@ -0,0 +1,148 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sessionConf "github.com/axfor/bast/session/conf"
+	"github.com/go-redis/redis"
+)
+
+//bucketScript refill and take a token from bucket
+//KEYS[1] is key, ARGV is capacity,rate(tokens of each millisecond),now(millisecond)
+//return allowed and tokens(string, the number of lua is truncated to integer)
+var bucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local v = redis.call('HMGET', KEYS[1], 't', 'l')
+local tokens = tonumber(v[1])
+local last = tonumber(v[2])
+if tokens == nil then
+	tokens = capacity
+elseif now > last then
+	tokens = math.min(capacity, tokens + (now - last) * rate)
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 't', tostring(tokens), 'l', math.max(now, last or now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+//windowScript count a request to sliding window
+//KEYS[1] is key, ARGV is limit,window(millisecond),now(millisecond)
+//return allowed, count and elapsed of current window
+var windowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local size = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local start = now - (now % size)
+local v = redis.call('HMGET', KEYS[1], 's', 'c', 'p')
+local s = tonumber(v[1])
+local current = tonumber(v[2]) or 0
+local previous = tonumber(v[3]) or 0
+if s ~= start then
+	if s == start - size then
+		previous = current
+	else
+		previous = 0
+	end
+	current = 0
+end
+local count = previous * (1 - (now - start) / size) + current
+local allowed = 0
+if count + 1 <= limit then
+	current = current + 1
+	count = count + 1
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 's', start, 'c', current, 'p', previous)
+redis.call('PEXPIRE', KEYS[1], size * 2)
+return {allowed, tostring(count), now - start}
+`)
+
+//Redis is redis store, limits are shared by all processes and nodes
+type Redis struct {
+	c      redis.UniversalClient
+	prefix string
+}
+
+//NewRedis create redis store
+//addrs of conf is a list split by ',', more than one is redis cluster
+func NewRedis(c *sessionConf.RedisConf, prefix string) (*Redis, error) {
+	if c == nil || c.Addrs == "" {
+		return nil, ErrorNotFondRedisConf
+	}
+	if prefix == "" {
+		prefix = "ratelimit:"
+	}
+	r := &Redis{
+		prefix: prefix,
+		c: redis.NewUniversalClient(&redis.UniversalOptions{
+			Addrs:    strings.Split(c.Addrs, ","),
+			Password: c.Password,
+			PoolSize: c.PoolSize,
+		}),
+	}
+	return r, r.c.Ping().Err()
+}
+
+//Take take a request from the quota of key
+func (r *Redis) Take(key string, p *Policy) (*Result, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	window := p.window()
+	ms := int64(window / time.Millisecond)
+	if p.Algorithm == TokenBucket {
+		rate := float64(p.Limit) / float64(ms)
+		v, err := bucketScript.Run(r.c, []string{r.prefix + "b:" + key}, p.burst(), strconv.FormatFloat(rate, 'f', -1, 64), now).Result()
+		if err != nil {
+			return nil, err
+		}
+		allowed, tokens, _, err := parse(v)
+		if err != nil {
+			return nil, err
+		}
+		return bucketResult(p, allowed, tokens), nil
+	}
+	v, err := windowScript.Run(r.c, []string{r.prefix + "w:" + key}, p.Limit, ms, now).Result()
+	if err != nil {
+		return nil, err
+	}
+	allowed, count, elapsed, err := parse(v)
+	if err != nil {
+		return nil, err
+	}
+	return windowResult(p, allowed, count, time.Duration(elapsed)*time.Millisecond), nil
+}
+
+//Close close the redis connection
+func (r *Redis) Close() error {
+	return r.c.Close()
+}
+
+//parse parse the reply of scripts {allowed, number, [elapsed]}
+func parse(v interface{}) (bool, float64, int64, error) {
+	vs, ok := v.([]interface{})
+	if !ok || len(vs) < 2 {
+		return false, 0, 0, fmt.Errorf("invalid rate limit reply %v", v)
+	}
+	allowed, _ := vs[0].(int64)
+	s, _ := vs[1].(string)
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return false, 0, 0, err
+	}
+	var elapsed int64
+	if len(vs) > 2 {
+		elapsed, _ = vs[2].(int64)
+	}
+	return allowed == 1, n, elapsed, nil
+}
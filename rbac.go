@@ -0,0 +1,212 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"net/http"
+
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/logs"
+)
+
+//PrincipalKey is the session key of principal(see DefaultPolicy)
+const PrincipalKey = "_principal"
+
+func init() {
+	//the principal of session is decoded by the other work processes(see session/serde)
+	gob.Register(&Principal{})
+}
+
+//Principal is the current user of request
+type Principal struct {
+	ID          string   `json:"id"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+//HasRole return principal has any-of the roles
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, r := range roles {
+		for _, v := range p.Roles {
+			if r == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//PolicyHandle is access control policy
+type PolicyHandle interface {
+	//Principal resolve the principal of current request, nil is anonymous
+	Principal(ctx *Context) *Principal
+	//Permissions return the permissions granted to role
+	Permissions(role string) []string
+}
+
+//DefaultPolicy resolve principal from jwt claims(sub,roles,permissions,scope)
+//or session(PrincipalKey) and grant role permissions from the 'rbac' app config
+type DefaultPolicy struct {
+	Roles map[string][]string
+}
+
+//Principal resolve the principal of current request
+func (d *DefaultPolicy) Principal(ctx *Context) *Principal {
+	if c := ctx.Claims(); c != nil {
+		p := &Principal{
+			ID:          c.Subject(),
+			Roles:       c.Strings("roles"),
+			Permissions: c.Strings("permissions"),
+		}
+		p.Permissions = append(p.Permissions, c.Strings("scope")...)
+		return p
+	}
+	return sessionPrincipal(ctx.SessionRead(PrincipalKey))
+}
+
+//sessionPrincipal return the principal of session value, the map is decoded by serialising session engines(such as redis)
+func sessionPrincipal(v interface{}) *Principal {
+	switch p := v.(type) {
+	case *Principal:
+		return p
+	case Principal:
+		return &p
+	case map[string]interface{}:
+		data, _ := json.Marshal(p)
+		pp := &Principal{}
+		if err := json.Unmarshal(data, pp); err != nil || pp.ID == "" && len(pp.Roles) == 0 && len(pp.Permissions) == 0 {
+			return nil
+		}
+		return pp
+	}
+	return nil
+}
+
+//Permissions return the permissions granted to role
+func (d *DefaultPolicy) Permissions(role string) []string {
+	if d.Roles != nil {
+		return d.Roles[role]
+	}
+	return nil
+}
+
+//Policy set the access control policy
+func Policy(p PolicyHandle) {
+	app.policy = p
+}
+
+//initPolicy init the default policy and rules from the 'rbac' app config
+func initPolicy(c *conf.RBACConf) {
+	app.rbac = c
+	app.rules = map[string]*conf.RBACRule{}
+	app.policy = &DefaultPolicy{Roles: c.Roles}
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		app.rules[r.Method+r.Pattern] = r
+	}
+}
+
+//Principal return the principal of current request(see Policy)
+func (c *Context) Principal() *Principal {
+	if c.principal == nil && app.policy != nil {
+		c.principal = app.policy.Principal(c)
+	}
+	return c.principal
+}
+
+//SetPrincipal set the principal of current request
+//and write it to session when session is enabled
+func (c *Context) SetPrincipal(p *Principal) {
+	c.principal = p
+	c.SessionWrite(PrincipalKey, p)
+}
+
+//Roles need any-of the roles to access api
+func (c *Pattern) Roles(roles ...string) *Pattern {
+	c.roles = roles
+	return c
+}
+
+//Permissions need all-of the permissions to access api
+func (c *Pattern) Permissions(permissions ...string) *Pattern {
+	c.permissions = permissions
+	return c
+}
+
+//Roles need any-of the roles to access group routes
+func (g *RouterGroup) Roles(roles ...string) *RouterGroup {
+	g.roles = roles
+	return g
+}
+
+//Permissions need all-of the permissions to access group routes
+func (g *RouterGroup) Permissions(permissions ...string) *RouterGroup {
+	g.permissions = permissions
+	return g
+}
+
+//permit check the roles and permissions of current route
+//the rules of route and 'rbac' app config are merged
+func permit(ctx *Context) bool {
+	pattern := ctx.Router
+	roles, permissions := pattern.roles, pattern.permissions
+	if r, ok := app.rules[pattern.Method+pattern.Pattern]; ok {
+		roles = append(append([]string{}, roles...), r.Roles...)
+		permissions = append(append([]string{}, permissions...), r.Permissions...)
+	}
+	if len(roles) == 0 && len(permissions) == 0 {
+		if app.rbac != nil && app.rbac.DenyDefault && pattern.authorization {
+			forbidden(ctx, nil, roles, permissions)
+			return false
+		}
+		return true
+	}
+	p := ctx.Principal()
+	if p == nil {
+		unauthorized(ctx, nil, nil)
+		return false
+	}
+	if len(roles) > 0 && !p.HasRole(roles...) {
+		forbidden(ctx, p, roles, permissions)
+		return false
+	}
+	if len(permissions) > 0 {
+		granted := map[string]bool{}
+		for _, v := range p.Permissions {
+			granted[v] = true
+		}
+		for _, r := range p.Roles {
+			for _, v := range app.policy.Permissions(r) {
+				granted[v] = true
+			}
+		}
+		if !granted["*"] {
+			for _, v := range permissions {
+				if !granted[v] {
+					forbidden(ctx, p, roles, permissions)
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+//forbidden output 403 to client and audit it
+func forbidden(ctx *Context, p *Principal, roles, permissions []string) {
+	id := ""
+	if p != nil {
+		id = p.ID
+	}
+	ctx.Log().Warn("access-denied",
+		logs.String("url", ctx.In.RequestURI),
+		logs.String("method", ctx.In.Method),
+		logs.String("principal", id),
+		logs.Strings("roles", roles),
+		logs.Strings("permissions", permissions),
+	)
+	ctx.Status(http.StatusForbidden)
+	ctx.FailResult(http.StatusText(http.StatusForbidden), SerAuthorizationFailed)
+}
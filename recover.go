@@ -0,0 +1,135 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/axfor/bast/logs"
+	"github.com/axfor/bast/metrics"
+)
+
+//RecoverHandle a panic handler for each request
+//err is the value of panic and stack is the stack of panic goroutine
+type RecoverHandle func(ctx *Context, err interface{}, stack []byte)
+
+//handlePanic is the panic of handle which is recovered by other goroutine(see Timeout)
+type handlePanic struct {
+	err   interface{}
+	stack []byte
+}
+
+//Recover set the request 'recover' handle, the default handle output
+//a SerError envelope(json,xml,yaml by accept) with 500 status to client
+func Recover(f RecoverHandle) {
+	app.Recover = f
+}
+
+//Panics return the panic count of api
+func (c *Pattern) Panics() uint64 {
+	return atomic.LoadUint64(&c.panics)
+}
+
+//PanicCounts return the panic count of each api(key is method and pattern, such as: GET /users/:id)
+//only the apis which has panicked are returned
+func PanicCounts() map[string]uint64 {
+	keys := make([]string, 0, len(app.pattern))
+	for k := range app.pattern {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	m := map[string]uint64{}
+	for _, k := range keys {
+		p := app.pattern[k]
+		if n := p.Panics(); n > 0 {
+			m[p.Method+" "+p.Pattern] = n
+		}
+	}
+	return m
+}
+
+//frameworkDir is the dir of bast package, its frames are skipped in the caller of panic
+var frameworkDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+//panicCaller return the first frame after the panic of stack which is not a runtime or bast frame(such as: api/user.go:12)
+//the frames of middlewares, timeout goroutine and handle chain are skipped
+func panicCaller(stack []byte) string {
+	lines := strings.Split(string(stack), "\n")
+	//the frames are function and file lines after the goroutine line
+	start := 1
+	for i := 1; i < len(lines); i += 2 {
+		if strings.HasPrefix(lines[i], "panic(") {
+			start = i + 2
+			break
+		}
+	}
+	for i := start; i+1 < len(lines); i += 2 {
+		fn := lines[i]
+		file := strings.TrimPrefix(lines[i+1], "\t")
+		if n := strings.LastIndex(file, " +0x"); n > 0 {
+			file = file[:n]
+		}
+		path := file
+		if n := strings.LastIndex(path, ":"); n > 0 {
+			path = path[:n]
+		}
+		if strings.HasPrefix(fn, "runtime.") || strings.HasPrefix(fn, "runtime/") ||
+			filepath.Dir(path) == frameworkDir && !strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		if n := strings.LastIndex(file, "/"); n > 0 {
+			if m := strings.LastIndex(file[:n], "/"); m >= 0 {
+				file = file[m+1:]
+			}
+		}
+		return file
+	}
+	return ""
+}
+
+//recovered handle the panic of request, it's logged with the caller(full stack in debug mode)
+func recovered(ctx *Context, err interface{}, start time.Time) {
+	stack := []byte(nil)
+	if p, ok := err.(*handlePanic); ok {
+		err, stack = p.err, p.stack
+	} else {
+		stack = debug.Stack()
+	}
+	caller := panicCaller(stack)
+	pattern := ctx.Router
+	n := atomic.AddUint64(&pattern.panics, 1)
+	metrics.Panics.WithLabelValues(pattern.Method, pattern.Pattern, pattern.Name).Inc()
+	stackField := logs.Skip()
+	if app.Debug {
+		stackField = logs.ByteString("stack", stack)
+	}
+	ctx.Log().ErrorWithCaller("handle-panic", logs.String("caller", caller),
+		logs.String("url", ctx.In.RequestURI),
+		logs.String("method", ctx.In.Method),
+		logs.Any("error", err),
+		logs.Uint64("panics", n),
+		logs.String("cost", time.Since(start).String()),
+		stackField,
+	)
+	if app.Recover != nil {
+		app.Recover(ctx, err, stack)
+		return
+	}
+	msg := http.StatusText(http.StatusInternalServerError)
+	if app.Debug {
+		msg = fmt.Sprint(err)
+	}
+	ctx.Status(http.StatusInternalServerError)
+	ctx.Failed(msg)
+}
@@ -0,0 +1,71 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/axfor/bast/httpc"
+	"github.com/axfor/bast/logs"
+)
+
+//maxRequestIDLen is the max length of accepted request id
+const maxRequestIDLen = 128
+
+//RequestID return the request id(X-Request-ID) of request
+//it's accepted from client or generated by the id node of app
+func (c *Context) RequestID() string {
+	return c.requestID
+}
+
+//Log return the logger of request, the request id is added to each log
+//the package-level logs.Info etc. don't know the request, so use it in handles instead
+func (c *Context) Log() *logs.Log {
+	if c.log == nil {
+		c.log = logs.With(logs.String("requestId", c.requestID))
+	}
+	return c.log
+}
+
+//LogOf return the logger of request context(see Context.Context), the request id is added to each log
+//it's used by the functions which are called with the context of request
+func LogOf(ctx context.Context) *logs.Log {
+	if id := httpc.RequestID(ctx); id != "" {
+		return logs.With(logs.String("requestId", id))
+	}
+	return logs.With()
+}
+
+//requestLog return the logger of request which is not handled by routes(such as: not found, method not allowed and options)
+//the request id is accepted or generated and echoed in the response
+func requestLog(w http.ResponseWriter, r *http.Request) *logs.Log {
+	id := requestID(r)
+	w.Header().Set(httpc.RequestIDHeader, id)
+	return logs.With(logs.String("requestId", id))
+}
+
+//requestID accept the X-Request-ID of request, otherwise generate it
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(httpc.RequestIDHeader); validRequestID(id) {
+		return id
+	}
+	if app.id != nil {
+		return strconv.FormatInt(app.id.GenerateWithInt64(), 10)
+	}
+	return ""
+}
+
+//validRequestID return id is not empty and only has visible ascii characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"time"
+
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/logs"
+)
+
+//state return the state of work process(running|restarting|failed|stopped)
+func (w *work) state() string {
+	switch {
+	case w.runing:
+		return "running"
+	case w.restarting:
+		return "restarting"
+	case w.failed:
+		return "failed"
+	}
+	return "stopped"
+}
+
+//crash record a crash of work process, false is it's crashed too many times in window
+func (w *work) crash(rc *conf.RestartConf, now time.Time) bool {
+	since := now.Add(-time.Duration(rc.Window) * time.Second)
+	crashes := w.crashes[:0]
+	for _, t := range w.crashes {
+		if t.After(since) {
+			crashes = append(crashes, t)
+		}
+	}
+	w.crashes = append(crashes, now)
+	return len(w.crashes) <= rc.MaxCrashes
+}
+
+//backoff return the delay of restart for the crashes in window, it's doubled for each crash
+func backoff(rc *conf.RestartConf, crashes int) time.Duration {
+	d := rc.Backoff
+	for i := 1; i < crashes && d < rc.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > rc.MaxBackoff {
+		d = rc.MaxBackoff
+	}
+	return time.Duration(d) * time.Millisecond
+}
+
+//restart restart the exited work process with backoff, it gives up when the work process is crash looping
+//crashed is whether it's exited with non-zero code or signal, the clean exits are not counted as crashes
+func (m *master) restart(index int, crashed bool) {
+	w := &app.cmd[index]
+	rc := conf.RestartOf(conf.WithKey(w.key))
+	if m.stopping || !app.runing || rc.Disable {
+		return
+	}
+	if !crashed {
+		w.restarting = true
+		m.restartAfter(index, backoff(rc, 1))
+		return
+	}
+	if !w.crash(rc, time.Now()) {
+		w.failed = true
+		logs.Error("work process is crash looping, give up restarting",
+			logs.String("key", w.key),
+			logs.Int("crashes", len(w.crashes)),
+			logs.Int64("window", rc.Window),
+			logs.Int("restarts", w.exitCount))
+		return
+	}
+	d := backoff(rc, len(w.crashes))
+	logs.Info("restart work process",
+		logs.String("key", w.key),
+		logs.String("backoff", d.String()),
+		logs.Int("restarts", w.exitCount))
+	w.restarting = true
+	m.restartAfter(index, d)
+}
+
+//restartAfter send the index to the check loop after d, it's dropped when the check loop is exited
+func (m *master) restartAfter(index int, d time.Duration) {
+	time.AfterFunc(d, func() {
+		select {
+		case m.restarts <- index:
+		case <-m.quit:
+		}
+	})
+}
+
+//started start the work process of restart, it's restarted again when it's failed
+func (m *master) started(index int) {
+	w := &app.cmd[index]
+	w.restarting = false
+	if m.stopping || !app.runing {
+		return
+	}
+	cmd := startWork(index)
+	if cmd == nil {
+		logs.Error("restart work process failed", logs.String("key", w.key))
+		m.restart(index, true)
+		return
+	}
+	m.wait(cmd)
+}
+
+//restartings return the count of work processes which are waiting to restart
+func restartings() int {
+	n := 0
+	for i := range app.cmd {
+		if app.cmd[i].restarting {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,32 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// +build linux
+
+package bast
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+//reusePort is supported on linux
+func reusePort() bool {
+	return true
+}
+
+//listenReusePort listen the address with SO_REUSEPORT, the kernel balance connections between work processes
+func listenReusePort(addr string) (net.Listener, error) {
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		var err error
+		if cerr := c.Control(func(fd uintptr) {
+			err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+		}); cerr != nil {
+			return cerr
+		}
+		return err
+	}}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
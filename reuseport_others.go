@@ -0,0 +1,20 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// +build !linux
+
+package bast
+
+import (
+	"errors"
+	"net"
+)
+
+//reusePort is not supported, the work processes share the listener of master
+func reusePort() bool {
+	return false
+}
+
+//listenReusePort is not supported
+func listenReusePort(addr string) (net.Listener, error) {
+	return nil, errors.New("SO_REUSEPORT is only supported on linux")
+}
@@ -1,23 +1,60 @@
 package bast
 
+import (
+	"time"
+
+	"github.com/axfor/bast/conf"
+)
+
 //Pattern Pattern obj
 type Pattern struct {
+	panics        uint64 //panic count, first field for 64-bit alignment of atomic
 	Method        string
 	Pattern       string
 	Fn            func(ctx *Context)
 	Parameter     interface{}
 	Name          string
 	Service       string
+	request       interface{}
+	response      interface{}
+	summary       string
+	middleware    []Middleware
+	schemes       []string
+	allSchemes    bool
+	roles         []string
+	permissions   []string
+	limiters      []*limiter
+	timeout       time.Duration
+	compress      *conf.CompressConf
+	etag          int8 //0 is 'etag' of app config, 1 is enabled, -1 is disabled
+	cache         *responseCache
+	cors          *corsPolicy
 	authorization bool
 	publish       bool
 	publishFinish bool
 	toRouter      bool
+	hidden        bool
+	probe         bool //health probe, it's exempt from app-level middleware, limiters, timeout and before/after
+	page          bool
 }
 
 //Auth need api authorization
 //eq Authorization
-func (c *Pattern) Auth() *Pattern {
+//schemes is the authorization schemes(see AuthScheme),any-of them must pass
+//without schemes the global 'authorization' handle is used
+func (c *Pattern) Auth(schemes ...string) *Pattern {
+	c.authorization = true
+	c.schemes = schemes
+	c.allSchemes = false
+	return c
+}
+
+//AuthAll need api authorization
+//schemes is the authorization schemes(see AuthScheme),all-of them must pass
+func (c *Pattern) AuthAll(schemes ...string) *Pattern {
 	c.authorization = true
+	c.schemes = schemes
+	c.allSchemes = true
 	return c
 }
 
@@ -25,6 +62,8 @@ func (c *Pattern) Auth() *Pattern {
 //eq Unauthorization
 func (c *Pattern) Unauth() *Pattern {
 	c.authorization = false
+	c.schemes = nil
+	c.allSchemes = false
 	return c
 }
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/axfor/bast/conf"
@@ -17,7 +18,7 @@ type Discovery struct {
 	prefix   string
 	nodes    map[string]map[string]string
 	client   *clientv3.Client
-	watching bool
+	watching int32 //1 is watching, it's written by the goroutine of Watch
 }
 
 //NewDiscovery create an clientv3 of etcd
@@ -98,14 +99,14 @@ func (d *Discovery) Sync() error {
 
 //Watch watch change of  all service nodes
 func (d *Discovery) Watch() {
-	if d.watching || d.prefix == "" {
+	if d.Watching() || d.prefix == "" {
 		return
 	}
 	err := d.Sync()
 	if err != nil {
 		logs.Errors("disconver sync error", err)
 	}
-	d.watching = true
+	atomic.StoreInt32(&d.watching, 1)
 	rch := d.client.Watch(context.TODO(), d.prefix, clientv3.WithPrefix())
 	for wresp := range rch {
 		for _, ev := range wresp.Events {
@@ -125,6 +126,12 @@ func (d *Discovery) Watch() {
 			}
 		}
 	}
+	atomic.StoreInt32(&d.watching, 0)
+}
+
+//Watching return the discovery is watching the change of service nodes
+func (d *Discovery) Watching() bool {
+	return atomic.LoadInt32(&d.watching) == 1
 }
 
 func (d *Discovery) updateNode(key, value string) {
@@ -167,7 +174,7 @@ func (d *Discovery) deleteNode(key string) {
 
 //Stop shuts down the client's etcd connections.
 func (d *Discovery) Stop() {
-	d.watching = false
+	atomic.StoreInt32(&d.watching, 0)
 	if d.client == nil {
 		return
 	}
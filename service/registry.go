@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/axfor/bast/conf"
 	"github.com/axfor/bast/logs"
+	"github.com/axfor/bast/metrics"
 	"go.etcd.io/etcd/clientv3"
 )
 
@@ -19,7 +21,8 @@ type Registry struct {
 	prefix       string
 	postfix      string
 	stop         chan struct{}
-	keepAliveing bool
+	keepAliveing int32 //1 is keeping alive, it's written by the goroutine of KeepAlive
+	registered   int32 //1 is a key is put
 }
 
 //NewRegistry create an clientv3 of etcd
@@ -60,7 +63,11 @@ func (r *Registry) Put(ctx context.Context, key, val string, opts ...clientv3.Op
 		return nil, errors.New("registry etcd client is nil")
 	}
 	key = r.prefix + key + r.postfix
-	return r.client.Put(ctx, key, val, r.op(opts)...)
+	rsp, err := r.client.Put(ctx, key, val, r.op(opts)...)
+	if err == nil {
+		atomic.StoreInt32(&r.registered, 1)
+	}
+	return rsp, err
 }
 
 //Get inwrap for clientv3.Get of etcd
@@ -134,7 +141,7 @@ func (r *Registry) Start() error {
 
 //KeepAlive start keepAlive
 func (r *Registry) KeepAlive() error {
-	if r.keepAliveing {
+	if r.Alive() {
 		return nil
 	}
 	if r.client == nil {
@@ -146,20 +153,23 @@ func (r *Registry) KeepAlive() error {
 		logs.Errors("registry start", err)
 		return err
 	}
-	r.keepAliveing = true
+	atomic.StoreInt32(&r.keepAliveing, 1)
+	alive := metrics.RegistryKeepAlive.WithLabelValues(r.prefix)
+	alive.Set(1)
+	defer alive.Set(0)
 	for {
 		select {
 		case <-r.stop:
 			r.revoke()
-			r.keepAliveing = false
+			atomic.StoreInt32(&r.keepAliveing, 0)
 			return nil
 		case <-r.client.Ctx().Done():
-			r.keepAliveing = false
+			atomic.StoreInt32(&r.keepAliveing, 0)
 			logs.Error("registry keepAlive done", logs.String("server", "server closed"))
 			return errors.New("server closed")
 		case _, ok := <-ch:
 			if !ok {
-				r.keepAliveing = false
+				atomic.StoreInt32(&r.keepAliveing, 0)
 				logs.Error("registry keepAlive close", logs.String("keepAlive", "keep alive channel closed"))
 				err := r.revoke()
 				return err
@@ -171,14 +181,24 @@ func (r *Registry) KeepAlive() error {
 	}
 }
 
+//Alive return the lease of registry is kept alive
+func (r *Registry) Alive() bool {
+	return atomic.LoadInt32(&r.keepAliveing) == 1
+}
+
+//Registered return a key is put to registry(the lease is kept alive after it's started)
+func (r *Registry) Registered() bool {
+	return atomic.LoadInt32(&r.registered) == 1
+}
+
 //Stop stop keepAlive
 func (r *Registry) Stop() {
-	if r.keepAliveing {
+	if r.Alive() {
 		if r.client == nil {
 			return
 		}
 		r.stop <- struct{}{}
-		r.keepAliveing = false
+		atomic.StoreInt32(&r.keepAliveing, 0)
 	}
 }
 
@@ -26,6 +26,11 @@ type Engine interface {
 	NeedRecycle() bool            //need recycle session store
 }
 
+//Pinger is the engine which can check its connection(such as: redis)
+type Pinger interface {
+	Ping() error //check the connection of store
+}
+
 //Engines all registered engine
 var Engines = map[string]Engine{}
 
@@ -145,6 +145,14 @@ func (en *sessionEngine) Get(id string) (engine.Store, error) {
 	return s, nil
 }
 
+//Ping check the connection of redis
+func (en *sessionEngine) Ping() error {
+	if en.c == nil {
+		return ErrorConn
+	}
+	return en.c.Ping().Err()
+}
+
 func (en *sessionEngine) Exist(id string) bool {
 	if en.c == nil {
 		return false
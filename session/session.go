@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/axfor/bast/ids"
+	"github.com/axfor/bast/metrics"
 	"github.com/axfor/bast/session/memory"
 	"github.com/axfor/bast/session/redis"
 	"github.com/axfor/bast/snowflake"
@@ -37,9 +38,14 @@ func Start(w http.ResponseWriter, r *http.Request) (engine.Store, error) {
 		return nil, errs
 	}
 
+	start := time.Now()
 	if sid != "" && engine.Exist(sid) {
-		return engine.Get(sid)
+		metrics.SessionLookups.WithLabelValues(sessionEngine, "hit").Inc()
+		store, err := engine.Get(sid)
+		metrics.SessionStoreDuration.WithLabelValues(sessionEngine, "load").Observe(time.Since(start).Seconds())
+		return store, err
 	}
+	metrics.SessionLookups.WithLabelValues(sessionEngine, "miss").Inc()
 	if idNode == nil {
 		idNode = ids.New()
 		if idNode == nil {
@@ -81,6 +87,26 @@ func Start(w http.ResponseWriter, r *http.Request) (engine.Store, error) {
 	return store, nil
 }
 
+//Commit commit the data of session store and record the latency of store
+func Commit(s engine.Store) error {
+	start := time.Now()
+	err := s.Commit()
+	metrics.SessionStoreDuration.WithLabelValues(cf.Engine, "commit").Observe(time.Since(start).Seconds())
+	return err
+}
+
+//Ping check the connection of session engine, it's nil when session is disabled
+//or the engine is not a pinger(such as: memory)
+func Ping() error {
+	if !cf.Enable {
+		return nil
+	}
+	if p, ok := engine.Engines[cf.Engine].(engine.Pinger); ok {
+		return p.Ping()
+	}
+	return nil
+}
+
 func getSid(r *http.Request) (string, error) {
 	cookie, errs := r.Cookie(cf.Name)
 	if errs != nil || cookie.Value == "" {
@@ -0,0 +1,135 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"sync/atomic"
+	"text/tabwriter"
+
+	"github.com/axfor/bast/pipe"
+)
+
+//inFlight is the count of requests which are serving
+var inFlight int64
+
+//Status is the status of master and work processes(see --status)
+type Status struct {
+	Master int          `json:"master"` //pid of master
+	Alive  bool         `json:"alive"`  //master is alive
+	Works  []WorkStatus `json:"works"`
+	OK     bool         `json:"ok"` //master and all work processes are running
+}
+
+//Version set the version of app, it's shown by --status(default is the version of main module)
+func Version(version string) {
+	app.version = version
+}
+
+//version return the version of app
+func version() string {
+	if app.version != "" {
+		return app.version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return ""
+}
+
+//getStatus return the status of master and work processes in the pid file
+func getStatus() *Status {
+	return collectStatus(getMasterPidWithFile(), getMasterPipeWithFile())
+}
+
+//collectStatus check the master and query the work processes by control pipes,
+//the work processes of pid file are checked when the master is not responding
+func collectStatus(mpid int, name string) *Status {
+	s := &Status{Master: mpid, Works: []WorkStatus{}}
+	s.Alive = mpid > 0 && processAlive(mpid)
+	ms := &MasterStatus{}
+	if s.Alive && name != "" && pipe.Call(name, cmdStatus, nil, ms, controlTimeout) == nil {
+		s.Works = ms.Works
+	} else {
+		for _, pid := range getWorkPidsFormFile() {
+			s.Works = append(s.Works, WorkStatus{Pid: pid, State: "unknown"})
+		}
+	}
+	s.OK = s.Alive && len(s.Works) > 0
+	for i := range s.Works {
+		w := &s.Works[i]
+		queryWork(name, w)
+		if !w.Runing || w.Error != "" {
+			s.OK = false
+		}
+	}
+	return s
+}
+
+//queryWork query the status of work process by its control pipe, the error is filled when it's down
+func queryWork(master string, w *WorkStatus) {
+	if w.Pid <= 0 || !processAlive(w.Pid) {
+		w.Runing = false
+		if w.State == "running" || w.State == "unknown" {
+			w.State = "down"
+		}
+		w.Error = "process is not alive"
+		return
+	}
+	if master == "" {
+		w.Error = "not found master pipe"
+		return
+	}
+	ws := &WorkStatus{}
+	if err := pipe.Call(workPipe(master, w.Pid), cmdStatus, nil, ws, controlTimeout); err != nil {
+		w.Error = err.Error()
+		return
+	}
+	w.Key, w.Worker, w.Runing = ws.Key, ws.Worker, ws.Runing
+	w.Addr, w.Start, w.Uptime = ws.Addr, ws.Start, ws.Uptime
+	w.InFlight, w.Version = ws.InFlight, ws.Version
+	if w.State == "unknown" && w.Runing {
+		w.State = "running"
+	}
+}
+
+//printStatus print the status as table or json
+func printStatus(out io.Writer, s *Status, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+	master := "down"
+	if s.Alive {
+		master = "running"
+	}
+	fmt.Fprintf(out, "master: %d %s\n", s.Master, master)
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tWORKER\tPID\tSTATE\tADDRESS\tUPTIME\tIN-FLIGHT\tRESTARTS\tVERSION\tERROR")
+	for _, w := range s.Works {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n", w.Key, w.Worker, w.Pid, w.State, w.Addr, w.Uptime, w.InFlight, w.Restarts, w.Version, w.Error)
+	}
+	return tw.Flush()
+}
+
+//status print the status of master and work processes, the exit code is 1 when any of them is down
+func status() {
+	s := getStatus()
+	if err := printStatus(os.Stdout, s, flagJSON); err != nil {
+		fmt.Println("status error,detail:" + err.Error())
+	}
+	if !s.OK {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+//inFlights return the count of requests which are serving
+func inFlights() int64 {
+	return atomic.LoadInt64(&inFlight)
+}
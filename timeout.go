@@ -0,0 +1,255 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/axfor/bast/httpc"
+	"github.com/axfor/bast/logs"
+	"github.com/axfor/bast/session"
+)
+
+//Timeout set the timeout of api, the context of request(see Context.Context) is canceled
+//when it's expired and a SerTry error is output to client(default is 'timeout' of app config)
+//the response is buffered until the handle is finished, Flush writes it and streams the rest(the SerTry error
+//can't be output after it) and Hijack works before the response is written.
+//negative is unlimited and the response is not buffered, use it for SendFile, streaming and SSE apis
+func (c *Pattern) Timeout(d time.Duration) *Pattern {
+	c.timeout = d
+	return c
+}
+
+//Timeout set the timeout of group routes(see Pattern.Timeout)
+func (g *RouterGroup) Timeout(d time.Duration) *RouterGroup {
+	g.timeout = d
+	return g
+}
+
+//Context return the context of request, it's canceled when the timeout is expired
+//or the client connection is closed
+func (c *Context) Context() context.Context {
+	if c.In != nil {
+		return c.In.Context()
+	}
+	return context.Background()
+}
+
+//HTTPClient return a http client of method and url(see httpc)
+//it inherit the deadline, cancellation and request id of request
+func (c *Context) HTTPClient(method, url string) *httpc.Client {
+	return httpc.NewRequest(method, url).Context(c.Context())
+}
+
+//ServiceClient return a http client of method and service name(see httpc.Service)
+//it inherit the deadline, cancellation and request id of request
+func (c *Context) ServiceClient(serviceName, method string) *httpc.Client {
+	return httpc.Service(serviceName, method).Context(c.Context())
+}
+
+//deadline return the timeout of pattern
+//the app timeout is not applied to the health probes
+func (c *Pattern) deadline() time.Duration {
+	if c.timeout != 0 || c.probe {
+		return c.timeout
+	}
+	return app.timeout
+}
+
+//serveTimeout run handle with timeout and output SerTry error to client when it's expired
+//return whether the handle is overrun, the ctx is still used by handle when it's true
+func serveTimeout(ctx *Context, handle Handle, d time.Duration) bool {
+	c, cancel := context.WithTimeout(ctx.In.Context(), d)
+	defer cancel()
+	r := ctx.In
+	w := ctx.Out
+	tw := &timeoutWriter{w: w, h: make(http.Header)}
+	ctx.In = r.WithContext(c)
+	ctx.Out = tw
+	done := make(chan struct{})
+	panicChan := make(chan *handlePanic, 1)
+	start := time.Now()
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				hp := &handlePanic{err: p, stack: debug.Stack()}
+				tw.mu.Lock()
+				overrun := tw.timedOut
+				if !overrun {
+					panicChan <- hp
+				}
+				tw.mu.Unlock()
+				if overrun {
+					recovered(ctx, hp, start)
+				}
+			}
+		}()
+		handle(ctx)
+		close(done)
+		tw.mu.Lock()
+		overrun := tw.timedOut
+		tw.mu.Unlock()
+		if overrun && ctx.Session != nil {
+			session.Commit(ctx.Session)
+		}
+	}()
+	select {
+	case p := <-panicChan:
+		ctx.Out = w
+		panic(p)
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		ctx.Out = w
+		tw.flush()
+		return false
+	case <-c.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		select {
+		case p := <-panicChan:
+			ctx.Out = w
+			panic(p)
+		case <-done:
+			//the handle is finished at the deadline
+			ctx.Out = w
+			tw.flush()
+			return false
+		default:
+		}
+		tw.timedOut = true
+		//ctx is still used by handle, so a new one is used to output
+		e := &Context{In: r, Out: w, Accept: ctx.Accept, KindAccept: ctx.KindAccept, Router: ctx.Router, requestID: ctx.requestID}
+		e.Log().Warn("handle-timeout",
+			logs.String("url", r.RequestURI),
+			logs.String("method", r.Method),
+			logs.String("timeout", d.String()),
+		)
+		if tw.streaming || tw.hijacked {
+			//the response is written, so only the context is canceled
+			return true
+		}
+		e.Status(http.StatusServiceUnavailable)
+		e.FailResult("timeout", SerTry)
+		return true
+	}
+}
+
+//timeoutWriter buffer the response of handle until it's finished or flushed
+type timeoutWriter struct {
+	w           http.ResponseWriter
+	h           http.Header
+	buf         bytes.Buffer
+	mu          sync.Mutex
+	timedOut    bool
+	wroteHeader bool
+	code        int
+	streaming   bool //the response is flushed, the writes are sent to client directly
+	hijacked    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if tw.streaming {
+		return tw.w.Write(p)
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.writeHeader(code)
+}
+
+func (tw *timeoutWriter) writeHeader(code int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.code = code
+}
+
+//flush write the buffered response to client
+func (tw *timeoutWriter) flush() {
+	if tw.streaming || tw.hijacked {
+		return
+	}
+	dst := tw.w.Header()
+	for k, vv := range tw.h {
+		dst[k] = vv
+	}
+	if !tw.wroteHeader {
+		tw.code = http.StatusOK
+	}
+	tw.w.WriteHeader(tw.code)
+	tw.w.Write(tw.buf.Bytes())
+}
+
+//Flush write the buffered response to client and stream the rest of it
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.hijacked {
+		return
+	}
+	tw.flush()
+	tw.streaming = true
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Hijack implements the http.Hijacker interface, it's failed after the response is written
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	if tw.streaming || tw.wroteHeader || tw.buf.Len() > 0 {
+		return nil, nil, errors.New("response has been written")
+	}
+	h, ok := tw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("not support http hijacker")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		tw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+//Push implements the http.Pusher interface
+func (tw *timeoutWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := tw.w.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
@@ -0,0 +1,107 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/axfor/bast/conf"
+	"github.com/axfor/bast/ids"
+	"github.com/axfor/bast/logs"
+)
+
+//workerIndexEnv is the index of work process in the work processes of app key, it's passed by master
+const workerIndexEnv = "BAST_WORKER_INDEX"
+
+//maxIDNode is the max id node of snowflake
+const maxIDNode = 255
+
+//workers return the count of work processes of app conf(default is 1, the memory session, rate limit and cache stores are per process)
+//it's 1 when the work processes can't share the address, and the id nodes of them must not overflow
+func workers(c *conf.AppConf) int {
+	n := c.Workers
+	if n <= 0 {
+		n = 1
+	}
+	if !handoff() && !useReusePort(c) {
+		return 1
+	}
+	if max := maxIDNode - int(c.IDNode) + 1; n > max {
+		logs.Error("too many work processes, the id nodes overflow",
+			logs.String("key", c.Key),
+			logs.Int("workers", n),
+			logs.Int("max", max))
+		n = max
+	}
+	return n
+}
+
+//checkIDNodes check the id nodes of the app confs which have multiple work processes(idNode to idNode + workers - 1)
+//are not overlapped with the id nodes of other app confs, the ids(see ID) of them collide when they are overlapped.
+//the app confs which have one work process are not checked, they share the id node as before
+func checkIDNodes(cs []conf.AppConf) error {
+	for i := range cs {
+		c := &cs[i]
+		n := workers(c)
+		if n <= 1 {
+			continue
+		}
+		for j := range cs {
+			o := &cs[j]
+			if i == j {
+				continue
+			}
+			from, to := int(o.IDNode), int(o.IDNode)+workers(o)-1
+			if from <= int(c.IDNode)+n-1 && int(c.IDNode) <= to {
+				return fmt.Errorf("the id nodes %d-%d of %s are overlapped with the id nodes %d-%d of %s", c.IDNode, int(c.IDNode)+n-1, c.Key, from, to, o.Key)
+			}
+		}
+	}
+	return nil
+}
+
+//useReusePort return the work processes of app conf listen with SO_REUSEPORT(tcp only)
+func useReusePort(c *conf.AppConf) bool {
+	return c != nil && c.ReusePort && reusePort() && !isUnix(c.Addr)
+}
+
+//workerIndex return the index of work process, it's 0 when it's not passed by master
+func workerIndex() int {
+	i, err := strconv.Atoi(os.Getenv(workerIndexEnv))
+	if err != nil || i < 0 {
+		return 0
+	}
+	return i
+}
+
+//workerIDNode set the id node of work process to idNode + worker index
+//so the ids(see ID) of sibling work processes never collide
+func workerIDNode(c *conf.AppConf) {
+	i := workerIndex()
+	if i == 0 || c == nil {
+		return
+	}
+	ids.SetIDNode(uint8(int(c.IDNode) + i))
+}
+
+//sameAddr return the listener is listening on the address(tcp or unix socket)
+func sameAddr(la net.Addr, addr string) bool {
+	if network, path := splitAddr(addr); network == "unix" {
+		return la.Network() == "unix" && la.String() == path
+	}
+	a, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return false
+	}
+	b, ok := la.(*net.TCPAddr)
+	if !ok || a.Port != b.Port {
+		return false
+	}
+	if len(a.IP) == 0 || a.IP.IsUnspecified() {
+		return b.IP.IsUnspecified()
+	}
+	return a.IP.Equal(b.IP)
+}